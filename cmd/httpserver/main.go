@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"crypto/sha256"
 	"fmt"
 	"log"
@@ -9,15 +10,19 @@ import (
 	"os/signal"
 	"strings"
 	"syscall"
+	"time"
 
 	"httpfromtcp/internal/headers"
 	"httpfromtcp/internal/request"
 	"httpfromtcp/internal/response"
+	"httpfromtcp/internal/router"
 	"httpfromtcp/internal/server"
 )
 
 const port = 42069
 
+const shutdownTimeout = 10 * time.Second
+
 func formatResponse(statusCode response.StatusCode) string {
 	body := "<html>\n\t<head>\n"
 	body += "\t</head>\n<body>"
@@ -51,84 +56,131 @@ func writeResponse(w *response.Writer, statusCode response.StatusCode) {
 	w.WriteHeaders(h)
 	// write the response body from the handler's buffer to the connection
 	w.WriteBody([]byte(body))
+}
 
-	w.WriteBody([]byte("\r\n"))
+func yourProblemHandler(w *response.Writer, req *request.Request) error {
+	writeResponse(w, response.StatusBadRequest)
+	return nil
 }
 
-func handlerFunc(w *response.Writer, req *request.Request)  {
-	if req.RequestLine.RequestTarget == "/yourproblem"{
-		writeResponse(w, response.StatusBadRequest)
-	} else if req.RequestLine.RequestTarget == "/myproblem" {
-		writeResponse(w, response.StatusInternalServerError)
-	} else if strings.HasPrefix(req.RequestLine.RequestTarget, "/httpbin/") {
-		target := req.RequestLine.RequestTarget
-		res, err := http.Get("https://httpbin.org/" + target[len("/httpbin/"):])
-		if err != nil {
-			writeResponse(w, response.StatusInternalServerError)
-		} else {
-			w.WriteStatusLine(response.StatusOK)
-
-			h := response.GetDefaultHeaders(int(res.ContentLength))
-			h.Delete("Content-Length")
-			h.Set("Transfer-Encoding", "chunked")
-			h.Set("Trailer", "X-Content-SHA256")
-			h.Set("Trailer", "X-Content-Length")
-			h.Replace("Content-Type", "text/plain")
-			w.WriteHeaders(h)
-			fullBody :=[]byte{}
-			for {
-				data := make([]byte, 32)
-				n, err := res.Body.Read(data)
-				if err != nil {
-					break
-				}
-				fullBody = append(fullBody, data[:n]...)
-				w.WriteBody([]byte(fmt.Sprintf("%x\r\n", n)))
-				w.WriteBody(data[:n])
-				w.WriteBody([]byte("\r\n"))
-			}
-			w.WriteBody([]byte("0\r\n"))
-			hash := sha256.Sum256(fullBody)
-			trailers := headers.NewHeaders()
-			trailers.Set("X-Content-SHA256", fmt.Sprintf("%x", hash))
-			trailers.Set("X-Content-Length", fmt.Sprintf("%d", len(fullBody)))
-			w.WriteHeaders(trailers)
-			w.WriteBody([]byte("\r\n"))
-			return
+func myProblemHandler(w *response.Writer, req *request.Request) error {
+	writeResponse(w, response.StatusInternalServerError)
+	return nil
+}
+
+// httpbinURL returns the httpbin.org URL a request to /httpbin/ is proxied to.
+// It is built from the target as it was sent rather than from the decoded
+// path, so that the path keeps its encoding and the query is forwarded too.
+func httpbinURL(req *request.Request) (string, error) {
+	target := req.RequestLine.Target
+	path, ok := strings.CutPrefix(target.RawPath, "/httpbin/")
+	if !ok {
+		// only reached through dot segments, e.g. "/video/../httpbin/get"
+		return "", &server.HandlerError{
+			StatusCode: response.StatusNotFound,
+			Message:    "Proxied paths can't contain dot segments.",
+		}
+	}
+	if target.RawQuery != "" {
+		path += "?" + target.RawQuery
+	}
+	return "https://httpbin.org/" + path, nil
+}
+
+func httpbinHandler(w *response.Writer, req *request.Request) error {
+	url, err := httpbinURL(req)
+	if err != nil {
+		return err
+	}
+	res, err := http.Get(url)
+	if err != nil {
+		return &server.HandlerError{
+			StatusCode: response.StatusBadGateway,
+			Message:    "Could not reach httpbin.org.",
 		}
-	} else if req.RequestLine.RequestTarget == "/video" {
-		w.WriteStatusLine(response.StatusOK)
-		filepath := "assets/vim.mp4"
-		video, err := os.ReadFile(filepath)
+	}
+	defer res.Body.Close()
+	w.WriteStatusLine(response.StatusOK)
+
+	h := response.GetDefaultHeaders(int(res.ContentLength))
+	h.Del("Content-Length")
+	h.Set("Transfer-Encoding", "chunked")
+	h.Set("Trailer", "X-Content-SHA256")
+	h.Add("Trailer", "X-Content-Length")
+	h.Set("Content-Type", "text/plain")
+	// the trailer is announced as spelled here, so keep that spelling
+	w.ForceSpelling("X-Content-SHA256")
+	w.WriteHeaders(h)
+	fullBody := []byte{}
+	body := w.ChunkedWriter()
+	for {
+		data := make([]byte, 32)
+		n, err := res.Body.Read(data)
+		fullBody = append(fullBody, data[:n]...)
+		body.Write(data[:n])
 		if err != nil {
-			log.Printf("error reading file: %v", filepath)
+			break
 		}
+	}
+	body.Close()
+	hash := sha256.Sum256(fullBody)
+	trailers := headers.NewHeaders()
+	trailers.Set("X-Content-SHA256", fmt.Sprintf("%x", hash))
+	trailers.Set("X-Content-Length", fmt.Sprintf("%d", len(fullBody)))
+	return w.WriteTrailers(trailers)
+}
 
-		h := response.GetDefaultHeaders(len(video))
-		h.Replace("Content-Type", "video/mp4")
-		w.WriteHeaders(h)
-		// write the response body from the handler's buffer to the connection
-		w.WriteBody(video)
+func videoHandler(w *response.Writer, req *request.Request) error {
+	filepath := "assets/vim.mp4"
+	video, err := os.ReadFile(filepath)
+	if err != nil {
+		return fmt.Errorf("error reading file %v: %w", filepath, err)
+	}
 
-		w.WriteBody([]byte("\r\n"))
+	w.WriteStatusLine(response.StatusOK)
+	h := response.GetDefaultHeaders(len(video))
+	h.Set("Content-Type", "video/mp4")
+	w.WriteHeaders(h)
+	// write the response body from the handler's buffer to the connection
+	_, err = w.WriteBody(video)
+	return err
+}
 
-	} else {
-		writeResponse(w, response.StatusOK)
-	}
+func rootHandler(w *response.Writer, req *request.Request) error {
+	writeResponse(w, response.StatusOK)
+	return nil
+}
+
+func newRouter() *router.Router {
+	r := router.NewRouter()
+	r.Get("/yourproblem", yourProblemHandler)
+	r.Get("/myproblem", myProblemHandler)
+	r.Get("/httpbin/{path...}", httpbinHandler)
+	r.Get("/video", videoHandler)
+	r.Handle("", "/", rootHandler)
+	return r
 }
 
 func main() {
-	server, err := server.Serve(port, handlerFunc)
+	server, err := server.ListenAndServe(server.Config{
+		Address: fmt.Sprintf(":%d", port),
+		Handler: server.Chain(newRouter().Serve, server.Logger),
+	})
 	if err != nil {
 		log.Fatalf("Error starting server: %v", err)
 	}
-	defer server.Close()
 	log.Println("Server started on port", port)
 
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 	<-sigChan
 
-
+	// give in-flight requests some time to finish before cutting them off
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("Error stopping server: %v", err)
+		return
+	}
 	log.Println("Server gracefully stopped")
 }
@@ -36,11 +36,12 @@ func main() {
 		fmt.Println("Request line:")
 		fmt.Printf("- Method: %v\n- Target: %v\n- Version: %v\n", r.RequestLine.Method, r.RequestLine.RequestTarget, r.RequestLine.HttpVersion)
 		fmt.Println("Headers:")
-		for key, value := range r.Headers {
+		for key, value := range r.Headers.All() {
 			fmt.Printf("- %v: %v\n", key, value)
 		}
 		fmt.Println("Body:")
-		fmt.Printf("%v\n", string(r.Body))
+		body, _ := r.ReadBody()
+		fmt.Printf("%v\n", string(body))
 
 		fmt.Println("The connection has been terminated")
 	}
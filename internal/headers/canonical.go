@@ -0,0 +1,51 @@
+package headers
+
+import "strings"
+
+// canonicalExceptions holds the well-known names whose usual spelling isn't
+// the capitalized words CanonicalName builds, keyed by their lower-case form
+var canonicalExceptions = map[string]string{
+	"content-id":               "Content-ID",
+	"content-md5":              "Content-MD5",
+	"dnt":                      "DNT",
+	"etag":                     "ETag",
+	"expect-ct":                "Expect-CT",
+	"nel":                      "NEL",
+	"sec-ch-ua":                "Sec-CH-UA",
+	"sec-ch-ua-mobile":         "Sec-CH-UA-Mobile",
+	"sec-ch-ua-platform":       "Sec-CH-UA-Platform",
+	"sec-websocket-accept":     "Sec-WebSocket-Accept",
+	"sec-websocket-extensions": "Sec-WebSocket-Extensions",
+	"sec-websocket-key":        "Sec-WebSocket-Key",
+	"sec-websocket-protocol":   "Sec-WebSocket-Protocol",
+	"sec-websocket-version":    "Sec-WebSocket-Version",
+	"te":                       "TE",
+	"www-authenticate":         "WWW-Authenticate",
+	"x-dns-prefetch-control":   "X-DNS-Prefetch-Control",
+	"x-ua-compatible":          "X-UA-Compatible",
+	"x-xss-protection":         "X-XSS-Protection",
+}
+
+// CanonicalName returns the spelling of a field name used on the wire: the
+// well-known exceptions such as "ETag" and "WWW-Authenticate" as they are
+// usually written, and otherwise the first letter of every dash-separated
+// word in upper case and the rest in lower case, e.g. "Content-Type". Names
+// that aren't tokens are returned unchanged.
+func CanonicalName(name string) string {
+	if !IsToken(name) {
+		return name
+	}
+	lower := strings.ToLower(name)
+	if canonical, ok := canonicalExceptions[lower]; ok {
+		return canonical
+	}
+	canonical := []byte(lower)
+	upper := true
+	for i, c := range canonical {
+		if upper && c >= 'a' && c <= 'z' {
+			canonical[i] = c - 'a' + 'A'
+		}
+		upper = c == '-'
+	}
+	return string(canonical)
+}
@@ -3,17 +3,29 @@ package headers
 import (
 	"bytes"
 	"fmt"
+	"iter"
 	"strings"
 )
 
-type Headers map[string]string
+// Headers holds the fields of a header or trailer section in the order they
+// were added, with the casing of their names as they were sent. Lookups are
+// case-insensitive and a name may have several values, e.g. Set-Cookie.
+type Headers struct {
+	fields []field
+}
+
+type field struct {
+	name  string
+	value string
+}
 
-func NewHeaders() Headers {
-	header := make(map[string]string)
-	return header
+func NewHeaders() *Headers {
+	return &Headers{}
 }
+
 const CLRF = "\r\n"
-func (h Headers) Parse(data []byte) (n int, done bool, err error) {
+
+func (h *Headers) Parse(data []byte) (n int, done bool, err error) {
 	idx := bytes.Index(data, []byte(CLRF))
 
 	if idx == -1 { // there is no CRLF
@@ -28,37 +40,132 @@ func (h Headers) Parse(data []byte) (n int, done bool, err error) {
 		return 0, false, err
 	}
 
-	h.Set(fieldName, fieldValue)
+	h.Add(fieldName, fieldValue)
 	return idx + 2, false, nil
 }
 
-func (h Headers) Get(key string) (value string) {
-	key = strings.ToLower(key)
-
-	value, ok := h[key]
-	if !ok {
+// Get returns the first value of key, or an empty string if there is none.
+// Use Values for fields that may be repeated.
+func (h *Headers) Get(key string) string {
+	if h == nil {
 		return ""
 	}
-	return value
+	for _, f := range h.fields {
+		if strings.EqualFold(f.name, key) {
+			return f.value
+		}
+	}
+	return ""
+}
+
+// Values returns every value of key, in the order they were added
+func (h *Headers) Values(key string) []string {
+	if h == nil {
+		return nil
+	}
+	var values []string
+	for _, f := range h.fields {
+		if strings.EqualFold(f.name, key) {
+			values = append(values, f.value)
+		}
+	}
+	return values
+}
+
+// Has reports whether key has at least one value, even an empty one
+func (h *Headers) Has(key string) bool {
+	if h == nil {
+		return false
+	}
+	for _, f := range h.fields {
+		if strings.EqualFold(f.name, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// Add appends a value to key, after any it already has
+func (h *Headers) Add(key, value string) {
+	h.fields = append(h.fields, field{name: key, value: value})
+}
+
+// Set replaces every value of key with value. The field keeps the position of
+// its first occurrence, or goes last if key had no value.
+func (h *Headers) Set(key, value string) {
+	found := false
+	kept := h.fields[:0]
+	for _, f := range h.fields {
+		if strings.EqualFold(f.name, key) {
+			if found {
+				continue
+			}
+			found = true
+			f = field{name: key, value: value}
+		}
+		kept = append(kept, f)
+	}
+	h.fields = kept
+	if !found {
+		h.Add(key, value)
+	}
+}
+
+// Del removes every value of key
+func (h *Headers) Del(key string) {
+	h.fields = deleteFields(h.fields, key)
+}
+
+func deleteFields(fields []field, key string) []field {
+	kept := fields[:0]
+	for _, f := range fields {
+		if !strings.EqualFold(f.name, key) {
+			kept = append(kept, f)
+		}
+	}
+	return kept
+}
+
+// Len returns the number of fields, counting each value of a repeated name
+func (h *Headers) Len() int {
+	if h == nil {
+		return 0
+	}
+	return len(h.fields)
 }
 
-func (h Headers) Set(key, value string) {
-	key = strings.ToLower(key)
-	if _, ok := h[key]; ok {
-		h[key] += ", " + value
-	} else {
-		h[key] = value
+// All iterates over the fields in order, yielding each name with its
+// original casing and one of its values
+func (h *Headers) All() iter.Seq2[string, string] {
+	return func(yield func(string, string) bool) {
+		if h == nil {
+			return
+		}
+		for _, f := range h.fields {
+			if !yield(f.name, f.value) {
+				return
+			}
+		}
 	}
 }
 
-func (h Headers) Replace(key, value string) {
-	key = strings.ToLower(key)
-	h[key] = value
+// Clone returns a copy of h that can be changed without affecting h
+func (h *Headers) Clone() *Headers {
+	if h == nil {
+		return NewHeaders()
+	}
+	return &Headers{fields: append([]field(nil), h.fields...)}
 }
 
-func (h Headers) Delete(key string) {
-	key = strings.ToLower(key)
-	delete(h, key)
+// HasToken reports whether the comma-separated values of key contain token,
+// compared case-insensitively (e.g. "close" in "Connection: keep-alive, close")
+func (h *Headers) HasToken(key, token string) bool {
+	for _, t := range h.List(key) {
+		if strings.EqualFold(t, token) {
+			return true
+		}
+	}
+	return false
 }
 
 func fieldLineFromString(str string) (fieldName string, fieldValue string, err error) {
@@ -70,26 +177,57 @@ func fieldLineFromString(str string) (fieldName string, fieldValue string, err e
 	}
 
 	fieldValue = strings.Join(fieldLineParts[1:], ":")
-	fieldValue = strings.Trim(fieldValue, " ")
+	fieldValue = strings.Trim(fieldValue, OWS)
 	if strings.Contains(fieldName, " ") {
 		return "", "", fmt.Errorf("error: there must be no spaces betwixt the colon and the field-name")
 	}
+	if err := ValidateFieldValue(fieldValue); err != nil {
+		return "", "", err
+	}
 
 	return fieldName, fieldValue, nil
 }
 
+// OWS is the optional whitespace around a field value, which isn't part of it
+const OWS = " \t"
+
+// ValidateFieldValue returns an error if value contains a control character
+// other than HTAB (RFC 9110 section 5.5). CR, LF and NUL in particular would
+// let a value end its field line early and inject fields of its own.
+// obs-text, the bytes 0x80 to 0xff, is accepted, as the grammar still allows
+// it for compatibility.
+func ValidateFieldValue(value string) error {
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if (c < ' ' && c != '\t') || c == 0x7f {
+			return fmt.Errorf("error: invalid character %q in the field value %q", c, value)
+		}
+	}
+	return nil
+}
+
+// Validate returns an error for the first field of h whose name isn't a
+// token or whose value isn't a valid field value, so that h can be written
+// to a connection as it is
+func (h *Headers) Validate() error {
+	for name, value := range h.All() {
+		if err := isValidFieldName(name); err != nil {
+			return err
+		}
+		if err := ValidateFieldValue(value); err != nil {
+			return fmt.Errorf("%w in field %v", err, name)
+		}
+	}
+	return nil
+}
+
 func isValidFieldName(str string) error {
 	if len(str) == 0 {
 		return fmt.Errorf("error: the field name length must be of at least 1")
 	}
-	const allowedSpecialCharacters = "!#$%&'*+-.^_`|~"
 
 	for _, c := range str {
-		isLetter := (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z')
-		isNumber := c >= '0' && c <= '9'
-		isSpecialCharacter := strings.ContainsRune(allowedSpecialCharacters, c)
-
-		if !isLetter && !isNumber && !isSpecialCharacter {
+		if !isTokenChar(c) {
 			return fmt.Errorf("error: invalid character %q in the field name %v", c, str)
 		}
 
@@ -97,3 +235,26 @@ func isValidFieldName(str string) error {
 
 	return nil
 }
+
+// IsToken reports whether s is a token, the grammar of field names and methods
+// (RFC 9110 section 5.6.2)
+func IsToken(s string) bool {
+	if len(s) == 0 {
+		return false
+	}
+	for _, c := range s {
+		if !isTokenChar(c) {
+			return false
+		}
+	}
+	return true
+}
+
+func isTokenChar(c rune) bool {
+	const allowedSpecialCharacters = "!#$%&'*+-.^_`|~"
+
+	isLetter := (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z')
+	isNumber := c >= '0' && c <= '9'
+	isSpecialCharacter := strings.ContainsRune(allowedSpecialCharacters, c)
+	return isLetter || isNumber || isSpecialCharacter
+}
@@ -15,7 +15,7 @@ func TestFieldLineParse(t *testing.T) {
 	n, done, err := headers.Parse(data)
 	require.NoError(t, err)
 	require.NotNil(t, headers)
-	assert.Equal(t, "localhost:42069", headers["host"])
+	assert.Equal(t, "localhost:42069", headers.Get("host"))
 	assert.Equal(t, 23, n)
 	assert.False(t, done)
 
@@ -34,18 +34,18 @@ func TestFieldLineParse(t *testing.T) {
 	fmt.Println(n)
 	require.NoError(t, err)
 	require.NotNil(t, headers)
-	assert.Equal(t, "localhost:42069", headers["host"])
+	assert.Equal(t, "localhost:42069", headers.Get("host"))
 	assert.Equal(t, 53, n)
 	assert.False(t, done)
 
 	// Test: Valid 2 headers with existing headers
 	headers = NewHeaders()
-	headers["Accept"] = "text"
+	headers.Set("Accept", "text")
 	data = []byte("Host: localhost:42069\r\n\r\n")
 	n, done, err = headers.Parse(data)
 	require.NoError(t, err)
 	require.NotNil(t, headers)
-	assert.Equal(t, "localhost:42069", headers["host"])
+	assert.Equal(t, "localhost:42069", headers.Get("host"))
 	assert.Equal(t, 23, n)
 	assert.False(t, done)
 
@@ -53,7 +53,7 @@ func TestFieldLineParse(t *testing.T) {
 	n, done, err = headers.Parse(data)
 	require.NoError(t, err)
 	require.NotNil(t, headers)
-	assert.Equal(t, "keep-alive", headers["connection"])
+	assert.Equal(t, "keep-alive", headers.Get("connection"))
 	assert.Equal(t, 23, n)
 	assert.False(t, done)
 
@@ -69,12 +69,105 @@ func TestFieldLineParse(t *testing.T) {
 	// Test: Invalid character in headers
 	headers = NewHeaders()
 	data = []byte("Host: localhost:42069\r\n\r\n")
-	headers["host"] = "nacho.com:12345"
+	headers.Set("host", "nacho.com:12345")
 	n, done, err = headers.Parse(data)
 	require.NoError(t, err)
 	require.NotNil(t, headers)
-	assert.Equal(t, "nacho.com:12345, localhost:42069", headers["host"])
+	assert.Equal(t, []string{"nacho.com:12345", "localhost:42069"}, headers.Values("host"))
 	assert.Equal(t, 23, n)
 	assert.False(t, done)
 
 }
+
+func TestHasToken(t *testing.T) {
+	headers := NewHeaders()
+	headers.Set("Connection", "keep-alive, Close")
+	assert.True(t, headers.HasToken("connection", "close"))
+	assert.True(t, headers.HasToken("Connection", "keep-alive"))
+	assert.False(t, headers.HasToken("Connection", "upgrade"))
+	assert.False(t, headers.HasToken("Transfer-Encoding", "chunked"))
+}
+
+func TestHeadersOrder(t *testing.T) {
+	headers := NewHeaders()
+	headers.Add("Content-Type", "text/html")
+	headers.Add("Set-Cookie", "a=1")
+	headers.Add("X-Request-ID", "42")
+	headers.Add("set-cookie", "b=2; Path=/")
+	assert.Equal(t, "a=1", headers.Get("SET-COOKIE"))
+	assert.Equal(t, []string{"a=1", "b=2; Path=/"}, headers.Values("Set-Cookie"))
+	assert.Nil(t, headers.Values("Missing"))
+	assert.True(t, headers.Has("x-request-id"))
+	assert.Equal(t, 4, headers.Len())
+
+	headers.Set("Content-Type", "text/plain")
+	headers.Set("Set-Cookie", "c=3")
+	headers.Add("Cache-Control", "no-store")
+	headers.Del("X-Request-Id")
+
+	var lines []string
+	for name, value := range headers.All() {
+		lines = append(lines, name+": "+value)
+	}
+	assert.Equal(t, []string{
+		"Content-Type: text/plain",
+		"Set-Cookie: c=3",
+		"Cache-Control: no-store",
+	}, lines)
+
+	clone := headers.Clone()
+	clone.Add("Vary", "Accept")
+	assert.False(t, headers.Has("Vary"))
+}
+
+func TestFieldValues(t *testing.T) {
+	// Test: tabs are optional whitespace around a value, and allowed inside it
+	headers := NewHeaders()
+	_, _, err := headers.Parse([]byte("X-List:\t a\tb \t\r\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "a\tb", headers.Get("X-List"))
+
+	// Test: obs-text is accepted
+	headers = NewHeaders()
+	_, _, err = headers.Parse([]byte("X-Name: caf\xe9\r\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "caf\xe9", headers.Get("X-Name"))
+
+	// Test: control characters are rejected
+	for _, line := range []string{"X-A: a\x00b\r\n", "X-A: a\rb\r\n", "X-A: a\nX-B: b\r\n", "X-A: \x1b[31m\r\n", "X-A: a\x7f\r\n"} {
+		headers = NewHeaders()
+		n, done, err := headers.Parse([]byte(line))
+		require.Error(t, err, "%q", line)
+		assert.Equal(t, 0, n)
+		assert.False(t, done)
+		assert.Equal(t, 0, headers.Len())
+	}
+
+	// Test: Validate checks fields set by the application
+	headers = NewHeaders()
+	headers.Set("Location", "/next")
+	require.NoError(t, headers.Validate())
+	headers.Set("Location", "/next\r\nSet-Cookie: admin=1")
+	require.Error(t, headers.Validate())
+	headers = NewHeaders()
+	headers.Set("Bad Name", "value")
+	require.Error(t, headers.Validate())
+}
+
+func TestCanonicalName(t *testing.T) {
+	tests := map[string]string{
+		"content-type":      "Content-Type",
+		"CONTENT-LENGTH":    "Content-Length",
+		"x-request-id":      "X-Request-Id",
+		"etag":              "ETag",
+		"Www-Authenticate":  "WWW-Authenticate",
+		"te":                "TE",
+		"sec-websocket-key": "Sec-WebSocket-Key",
+		"a--b-":             "A--B-",
+		"x-2fa":             "X-2fa",
+		"bad name":          "bad name",
+	}
+	for name, want := range tests {
+		assert.Equal(t, want, CanonicalName(name), name)
+	}
+}
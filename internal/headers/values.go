@@ -0,0 +1,309 @@
+package headers
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrMissingField is returned by the typed accessors when the field isn't set
+var ErrMissingField = errors.New("missing header field")
+
+// ParseList splits a comma-separated list into its elements, with their
+// surrounding whitespace trimmed and the empty ones dropped (RFC 9110 section
+// 5.6.1). Commas inside quoted strings don't split the list, and the quoted
+// strings are kept as they are, quotes included, e.g. `"a,b", c` is `"a,b"`
+// and `c`.
+func ParseList(value string) []string {
+	var elements []string
+	for _, element := range splitOutsideQuotes(value, ',') {
+		if element = strings.Trim(element, OWS); element != "" {
+			elements = append(elements, element)
+		}
+	}
+	return elements
+}
+
+// List returns the elements of every value of key, as split by ParseList
+func (h *Headers) List(key string) []string {
+	var elements []string
+	for _, value := range h.Values(key) {
+		elements = append(elements, ParseList(value)...)
+	}
+	return elements
+}
+
+// splitOutsideQuotes splits s at every sep that isn't inside a quoted string
+func splitOutsideQuotes(s string, sep byte) []string {
+	var parts []string
+	start := 0
+	quoted := false
+	for i := 0; i < len(s); i++ {
+		switch {
+		case quoted && s[i] == '\\':
+			// the escaped byte can't end the string
+			i++
+		case s[i] == '"':
+			quoted = !quoted
+		case s[i] == sep && !quoted:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// ParseLength parses a length such as a Content-Length, digits without a sign.
+// A list of identical values, which is what duplicated fields become once
+// combined, is accepted as that value (RFC 9110 section 8.6).
+func ParseLength(value string) (int, error) {
+	values := strings.Split(value, ",")
+	first := strings.Trim(values[0], OWS)
+	for _, v := range values {
+		v = strings.Trim(v, OWS)
+		if !isDigits(v) || v != first {
+			return 0, fmt.Errorf("error: invalid length %q", value)
+		}
+	}
+	length, err := strconv.Atoi(first)
+	if err != nil {
+		return 0, fmt.Errorf("error: invalid length %q: %w", value, err)
+	}
+	return length, nil
+}
+
+// Length parses every value of key with ParseLength, so that they must all be
+// the same
+func (h *Headers) Length(key string) (int, error) {
+	values := h.Values(key)
+	if len(values) == 0 {
+		return 0, fmt.Errorf("%w: %v", ErrMissingField, key)
+	}
+	return ParseLength(strings.Join(values, ", "))
+}
+
+// ContentLength returns the Content-Length of the message
+func (h *Headers) ContentLength() (int, error) {
+	return h.Length("Content-Length")
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseMediaType parses a media type and its parameters, e.g.
+// `text/html; charset="utf-8"` (RFC 9110 section 8.3.1). The type, subtype
+// and parameter names are lower-cased, since they are case-insensitive, and
+// quoted parameter values are unquoted.
+func ParseMediaType(value string) (mediaType string, params map[string]string, err error) {
+	mediaType, rest := value, ""
+	if i := strings.IndexByte(value, ';'); i != -1 {
+		mediaType, rest = value[:i], value[i:]
+	}
+	mediaType = strings.ToLower(strings.Trim(mediaType, OWS))
+	typ, subtype, ok := strings.Cut(mediaType, "/")
+	if !ok || !IsToken(typ) || !IsToken(subtype) {
+		return "", nil, fmt.Errorf("error: invalid media type %q", value)
+	}
+	params, err = parseParameters(rest)
+	if err != nil {
+		return "", nil, fmt.Errorf("error: invalid parameters in media type %q: %w", value, err)
+	}
+	return mediaType, params, nil
+}
+
+// ContentType returns the media type and parameters of the Content-Type
+func (h *Headers) ContentType() (mediaType string, params map[string]string, err error) {
+	if !h.Has("Content-Type") {
+		return "", nil, fmt.Errorf("%w: Content-Type", ErrMissingField)
+	}
+	return ParseMediaType(h.Get("Content-Type"))
+}
+
+// parseParameters parses the ";"-separated name=value pairs that follow a
+// media type, where empty parameters are allowed and ignored
+func parseParameters(s string) (map[string]string, error) {
+	params := map[string]string{}
+	for {
+		s = strings.TrimLeft(s, OWS)
+		if s == "" {
+			return params, nil
+		}
+		if s[0] != ';' {
+			return nil, fmt.Errorf("error: expected ';' before %q", s)
+		}
+		s = strings.TrimLeft(s[1:], OWS)
+		if s == "" || s[0] == ';' {
+			continue
+		}
+		name, rest, ok := strings.Cut(s, "=")
+		if !ok || !IsToken(name) {
+			return nil, fmt.Errorf("error: invalid parameter %q", s)
+		}
+		value, rest, err := cutParameterValue(rest)
+		if err != nil {
+			return nil, err
+		}
+		params[strings.ToLower(name)] = value
+		s = rest
+	}
+}
+
+// cutParameterValue cuts the token or quoted string at the start of s
+func cutParameterValue(s string) (value, rest string, err error) {
+	if strings.HasPrefix(s, `"`) {
+		return cutQuotedString(s)
+	}
+	i := 0
+	for i < len(s) && isTokenChar(rune(s[i])) {
+		i++
+	}
+	if i == 0 {
+		return "", "", fmt.Errorf("error: missing parameter value before %q", s)
+	}
+	return s[:i], s[i:], nil
+}
+
+// cutQuotedString cuts the quoted string at the start of s and returns it
+// without its quotes and escaping backslashes
+func cutQuotedString(s string) (value, rest string, err error) {
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+			if i == len(s) {
+				return "", "", fmt.Errorf("error: unterminated quoted string %q", s)
+			}
+			b.WriteByte(s[i])
+		case '"':
+			return b.String(), s[i+1:], nil
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return "", "", fmt.Errorf("error: unterminated quoted string %q", s)
+}
+
+// TimeFormat is the IMF-fixdate format that HTTP dates are sent in, e.g.
+// "Sun, 06 Nov 1994 08:49:37 GMT"
+const TimeFormat = "Mon, 02 Jan 2006 15:04:05 GMT"
+
+// timeFormats are the formats recipients must accept (RFC 9110 section
+// 5.6.7): IMF-fixdate, then the obsolete RFC 850 and asctime formats
+var timeFormats = []string{
+	TimeFormat,
+	"Monday, 02-Jan-06 15:04:05 GMT",
+	"Mon Jan _2 15:04:05 2006",
+}
+
+// ParseTime parses an HTTP date in any of the three formats of RFC 9110,
+// which are all in UTC
+func ParseTime(value string) (time.Time, error) {
+	for _, format := range timeFormats {
+		if t, err := time.Parse(format, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("error: invalid HTTP date %q", value)
+}
+
+// FormatTime formats t as an IMF-fixdate, the format HTTP dates are sent in
+func FormatTime(t time.Time) string {
+	return t.UTC().Format(TimeFormat)
+}
+
+// Time returns the HTTP date in the first value of key, e.g. Date or
+// If-Modified-Since
+func (h *Headers) Time(key string) (time.Time, error) {
+	if !h.Has(key) {
+		return time.Time{}, fmt.Errorf("%w: %v", ErrMissingField, key)
+	}
+	return ParseTime(h.Get(key))
+}
+
+// SetTime sets key to t formatted as an HTTP date
+func (h *Headers) SetTime(key string, t time.Time) {
+	h.Set(key, FormatTime(t))
+}
+
+// QualityValue is an element of a list weighted with quality values, such as
+// Accept or Accept-Encoding
+type QualityValue struct {
+	// Value is the element without its weight, e.g. "text/html;level=1"
+	Value string
+	// Q is the weight, from 0 to 1, 0 meaning "not acceptable"
+	Q float64
+}
+
+// ParseQualityList parses a list weighted with quality values (RFC 9110
+// section 12.4.2), e.g. "text/html, application/json;q=0.9". The elements
+// are sorted by decreasing weight, those of equal weight keeping their order.
+// An element without a weight has a weight of 1, one with an invalid weight
+// is dropped.
+func ParseQualityList(value string) []QualityValue {
+	var list []QualityValue
+	for _, element := range ParseList(value) {
+		if qv, ok := parseQualityValue(element); ok {
+			list = append(list, qv)
+		}
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].Q > list[j].Q
+	})
+	return list
+}
+
+// QualityList parses every value of key with ParseQualityList
+func (h *Headers) QualityList(key string) []QualityValue {
+	return ParseQualityList(strings.Join(h.Values(key), ", "))
+}
+
+// parseQualityValue splits the weight off an element, the weight being its
+// last parameter when that is named q
+func parseQualityValue(element string) (QualityValue, bool) {
+	parts := splitOutsideQuotes(element, ';')
+	if len(parts) == 1 {
+		return QualityValue{Value: element, Q: 1}, true
+	}
+	name, weight, _ := strings.Cut(parts[len(parts)-1], "=")
+	if !strings.EqualFold(strings.Trim(name, OWS), "q") {
+		return QualityValue{Value: element, Q: 1}, true
+	}
+	q, ok := parseQValue(strings.Trim(weight, OWS))
+	if !ok {
+		return QualityValue{}, false
+	}
+	value := strings.Trim(strings.Join(parts[:len(parts)-1], ";"), OWS)
+	return QualityValue{Value: value, Q: q}, true
+}
+
+// parseQValue parses a weight, "0" or "1" followed by up to three decimals,
+// and no more than 1
+func parseQValue(s string) (float64, bool) {
+	if s == "" || (s[0] != '0' && s[0] != '1') {
+		return 0, false
+	}
+	if len(s) > 1 {
+		decimals, ok := strings.CutPrefix(s[1:], ".")
+		if !ok || len(decimals) > 3 || (decimals != "" && !isDigits(decimals)) {
+			return 0, false
+		}
+		if s[0] == '1' && strings.Trim(decimals, "0") != "" {
+			return 0, false
+		}
+	}
+	q, err := strconv.ParseFloat(s, 64)
+	return q, err == nil
+}
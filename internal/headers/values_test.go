@@ -0,0 +1,120 @@
+package headers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseList(t *testing.T) {
+	assert.Equal(t, []string{"gzip", "chunked"}, ParseList("gzip, chunked"))
+	assert.Equal(t, []string{"a", "b"}, ParseList(" ,a,\t, b ,"))
+	assert.Equal(t, []string{`"a,b"`, `W/"c\",d"`, "e"}, ParseList(`"a,b", W/"c\",d", e`))
+	assert.Nil(t, ParseList(""))
+
+	h := NewHeaders()
+	h.Add("Cache-Control", "no-cache, max-age=0")
+	h.Add("cache-control", `private="Set-Cookie, Vary"`)
+	assert.Equal(t, []string{"no-cache", "max-age=0", `private="Set-Cookie, Vary"`}, h.List("Cache-Control"))
+	assert.False(t, h.HasToken("Cache-Control", "Vary"))
+}
+
+func TestParseLength(t *testing.T) {
+	for value, want := range map[string]int{"0": 0, "42": 42, "42, 42": 42, " 7\t": 7} {
+		n, err := ParseLength(value)
+		require.NoError(t, err, value)
+		assert.Equal(t, want, n)
+	}
+	for _, value := range []string{"", "-1", "+1", "0x10", "1.5", "4, 40", "4,", "99999999999999999999999"} {
+		_, err := ParseLength(value)
+		require.Error(t, err, value)
+	}
+
+	h := NewHeaders()
+	_, err := h.ContentLength()
+	require.ErrorIs(t, err, ErrMissingField)
+	h.Add("Content-Length", "12")
+	h.Add("Content-Length", "12")
+	n, err := h.ContentLength()
+	require.NoError(t, err)
+	assert.Equal(t, 12, n)
+	h.Add("Content-Length", "13")
+	_, err = h.ContentLength()
+	require.Error(t, err)
+}
+
+func TestParseMediaType(t *testing.T) {
+	mediaType, params, err := ParseMediaType(`Text/HTML; Charset="utf-8" ;level=1;; q="a \"b\"; c"`)
+	require.NoError(t, err)
+	assert.Equal(t, "text/html", mediaType)
+	assert.Equal(t, map[string]string{"charset": "utf-8", "level": "1", "q": `a "b"; c`}, params)
+
+	mediaType, params, err = ParseMediaType("*/*")
+	require.NoError(t, err)
+	assert.Equal(t, "*/*", mediaType)
+	assert.Empty(t, params)
+
+	for _, value := range []string{"", "text", "text/", "te xt/html", "text/html; charset", "text/html; charset=", `text/html; a="b`, "text/html junk"} {
+		_, _, err := ParseMediaType(value)
+		require.Error(t, err, value)
+	}
+
+	h := NewHeaders()
+	_, _, err = h.ContentType()
+	require.ErrorIs(t, err, ErrMissingField)
+	h.Set("Content-Type", "application/json; charset=utf-8")
+	mediaType, params, err = h.ContentType()
+	require.NoError(t, err)
+	assert.Equal(t, "application/json", mediaType)
+	assert.Equal(t, "utf-8", params["charset"])
+}
+
+func TestParseTime(t *testing.T) {
+	want := time.Date(1994, time.November, 6, 8, 49, 37, 0, time.UTC)
+	for _, value := range []string{
+		"Sun, 06 Nov 1994 08:49:37 GMT",
+		"Sunday, 06-Nov-94 08:49:37 GMT",
+		"Sun Nov  6 08:49:37 1994",
+	} {
+		got, err := ParseTime(value)
+		require.NoError(t, err, value)
+		assert.True(t, want.Equal(got), value)
+	}
+	for _, value := range []string{"", "yesterday", "Sun, 06 Nov 1994 08:49:37 PST", "1994-11-06T08:49:37Z"} {
+		_, err := ParseTime(value)
+		require.Error(t, err, value)
+	}
+
+	paris := time.FixedZone("CET", 3600)
+	assert.Equal(t, "Sun, 06 Nov 1994 08:49:37 GMT", FormatTime(want.In(paris)))
+
+	h := NewHeaders()
+	_, err := h.Time("Last-Modified")
+	require.ErrorIs(t, err, ErrMissingField)
+	h.SetTime("Last-Modified", want)
+	assert.Equal(t, "Sun, 06 Nov 1994 08:49:37 GMT", h.Get("Last-Modified"))
+	got, err := h.Time("last-modified")
+	require.NoError(t, err)
+	assert.True(t, want.Equal(got))
+}
+
+func TestParseQualityList(t *testing.T) {
+	assert.Equal(t, []QualityValue{
+		{Value: "text/html;level=1", Q: 1},
+		{Value: "application/json", Q: 1},
+		{Value: "text/plain", Q: 0.5},
+		{Value: "*/*", Q: 0.1},
+		{Value: "image/png", Q: 0},
+	}, ParseQualityList("text/plain; q=0.5, text/html;level=1, */*;Q=0.1, image/png;q=0, application/json;q=1.000"))
+
+	// Test: elements with an invalid weight are dropped
+	assert.Equal(t, []QualityValue{{Value: "gzip", Q: 1}}, ParseQualityList("gzip, br;q=2, zstd;q=0.1234, deflate;q=1.5, identity;q=.5, x;q="))
+
+	h := NewHeaders()
+	h.Add("Accept-Encoding", "gzip;q=0.8")
+	h.Add("Accept-Encoding", "br")
+	assert.Equal(t, []QualityValue{{Value: "br", Q: 1}, {Value: "gzip", Q: 0.8}}, h.QualityList("Accept-Encoding"))
+	assert.Nil(t, h.QualityList("Accept"))
+}
@@ -0,0 +1,94 @@
+package request
+
+import (
+	"io"
+	"sync"
+)
+
+// body is the Body of a request read by a Reader. It parses the bytes of the
+// connection as they are read, so it must be read before the next request.
+type body struct {
+	reader *Reader
+	req    *Request
+
+	err       error // io.EOF once the whole body was read
+	done      chan struct{}
+	closeOnce sync.Once
+	started   bool // Read was called
+}
+
+func (b *body) Read(p []byte) (int, error) {
+	req := b.req
+	if len(req.pending) == 0 && b.err != nil {
+		// once done, reads don't modify anything, so the server can check a
+		// body the handler is still reading
+		return 0, b.err
+	}
+	if !b.started {
+		b.started = true
+		if req.expectContinue && req.continueHook != nil {
+			// the client only sends the body once told to
+			if err := req.continueHook(); err != nil {
+				b.finish(err)
+			}
+		}
+	}
+	for len(req.pending) == 0 {
+		if b.err != nil {
+			return 0, b.err
+		}
+		if req.ParserState == requestStateDone {
+			b.finish(io.EOF)
+			continue
+		}
+		// parse what is already buffered before waiting for more
+		parsed := req.parsed
+		err := b.reader.parseBuffered(req)
+		if err == nil && req.parsed == parsed {
+			err = b.reader.fill(req)
+		}
+		if err != nil {
+			b.finish(err)
+		}
+	}
+
+	n := copy(p, req.pending)
+	if n == len(req.pending) {
+		// reuse the pending buffer
+		req.pending = req.pending[:0]
+	} else {
+		req.pending = req.pending[n:]
+	}
+	return n, nil
+}
+
+// finish records the error every further Read returns
+func (b *body) finish(err error) {
+	b.err = err
+	b.closeOnce.Do(func() { close(b.done) })
+}
+
+// BodyDone returns a channel that is closed once Body has been read to its end,
+// or failed. The connection can then be read again.
+func (r *Request) BodyDone() <-chan struct{} {
+	return r.body.done
+}
+
+// ExpectsContinue reports whether the client sent "Expect: 100-continue" and
+// waits for a 100 Continue response before sending the body
+func (r *Request) ExpectsContinue() bool {
+	return r.expectContinue
+}
+
+// SetContinueHook sets the function writing the 100 Continue response, it is
+// called the first time Body is read if the client expects one. An error
+// fails the read.
+func (r *Request) SetContinueHook(hook func() error) {
+	r.continueHook = hook
+}
+
+// ReadBody reads the rest of the body into memory, which is meant for small
+// requests. The body limits of the Reader still apply.
+func (r *Request) ReadBody() ([]byte, error) {
+	return io.ReadAll(r.Body)
+}
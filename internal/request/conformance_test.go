@@ -0,0 +1,74 @@
+package request
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRequestLineConformance checks the request-line, Host and field value
+// rules of RFC 9110 and 9112 in both parsing modes, a nil error meaning the
+// request is accepted
+func TestRequestLineConformance(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		strict  error
+		lenient error
+	}{
+		{"simple", "GET / HTTP/1.1\r\nHost: a\r\n\r\n", nil, nil},
+		{"token method", "M-SEARCH /upnp HTTP/1.1\r\nHost: a\r\n\r\n", nil, nil},
+		{"asterisk outside OPTIONS", "GET * HTTP/1.1\r\nHost: a\r\n\r\n", ErrInvalidTarget, ErrInvalidTarget},
+		{"extension method", "PURGE /cache HTTP/1.1\r\nHost: a\r\n\r\n", nil, nil},
+		{"lowercase method", "get / HTTP/1.1\r\nHost: a\r\n\r\n", nil, nil},
+		{"method with separator", "GE(T / HTTP/1.1\r\nHost: a\r\n\r\n", ErrInvalidMethod, ErrInvalidMethod},
+		{"method with non-ASCII", "GÉT / HTTP/1.1\r\nHost: a\r\n\r\n", ErrInvalidMethod, ErrInvalidMethod},
+		{"leading empty line", "\r\nGET / HTTP/1.1\r\nHost: a\r\n\r\n", nil, nil},
+		{"double space", "GET  / HTTP/1.1\r\nHost: a\r\n\r\n", ErrMalformedRequestLine, nil},
+		{"tab separator", "GET\t/\tHTTP/1.1\r\nHost: a\r\n\r\n", ErrMalformedRequestLine, nil},
+		{"leading space", " GET / HTTP/1.1\r\nHost: a\r\n\r\n", ErrMalformedRequestLine, nil},
+		{"trailing space", "GET / HTTP/1.1 \r\nHost: a\r\n\r\n", ErrMalformedRequestLine, nil},
+		{"bare CR separator", "GET\r/ HTTP/1.1\r\nHost: a\r\n\r\n", ErrMalformedRequestLine, nil},
+		{"space in target", "GET /a b HTTP/1.1\r\nHost: a\r\n\r\n", ErrMalformedRequestLine, ErrMalformedRequestLine},
+		{"control character in target", "GET /a\x01b HTTP/1.1\r\nHost: a\r\n\r\n", ErrInvalidTarget, ErrInvalidTarget},
+		{"DEL in target", "GET /a\x7f HTTP/1.1\r\nHost: a\r\n\r\n", ErrInvalidTarget, ErrInvalidTarget},
+		{"non-ASCII target", "GET /café HTTP/1.1\r\nHost: a\r\n\r\n", ErrInvalidTarget, nil},
+		{"missing version", "GET /\r\nHost: a\r\n\r\n", ErrMalformedRequestLine, ErrMalformedRequestLine},
+		{"lowercase version", "GET / http/1.1\r\nHost: a\r\n\r\n", ErrInvalidVersion, ErrInvalidVersion},
+		{"missing Host", "GET / HTTP/1.1\r\n\r\n", ErrInvalidHost, nil},
+		{"empty Host", "GET / HTTP/1.1\r\nHost:\r\n\r\n", nil, nil},
+		{"duplicate Host", "GET / HTTP/1.1\r\nHost: a\r\nHost: b\r\n\r\n", ErrInvalidHost, nil},
+		{"HTTP/1.0 without Host", "GET / HTTP/1.0\r\n\r\n", nil, nil},
+		{"tabs around a field value", "GET / HTTP/1.1\r\nHost:\ta \t\r\n\r\n", nil, nil},
+		{"tab in a field value", "GET / HTTP/1.1\r\nHost: a\r\nX-List: a\tb\r\n\r\n", nil, nil},
+		{"obs-text in a field value", "GET / HTTP/1.1\r\nHost: a\r\nX-Name: café\r\n\r\n", ErrMalformedHeader, nil},
+		{"NUL in a field value", "GET / HTTP/1.1\r\nHost: a\x00\r\n\r\n", ErrMalformedHeader, ErrMalformedHeader},
+		{"bare CR in a field value", "GET / HTTP/1.1\r\nHost: a\rb\r\n\r\n", ErrMalformedHeader, ErrMalformedHeader},
+		{"DEL in a field value", "GET / HTTP/1.1\r\nHost: a\x7f\r\n\r\n", ErrMalformedHeader, ErrMalformedHeader},
+	}
+	for _, tt := range tests {
+		for _, lenient := range []bool{false, true} {
+			want := tt.strict
+			if lenient {
+				want = tt.lenient
+			}
+			name := tt.name
+			if lenient {
+				name += " (lenient)"
+			}
+			t.Run(name, func(t *testing.T) {
+				reader := NewReader(strings.NewReader(tt.data))
+				reader.Lenient = lenient
+				r, err := reader.ReadRequest()
+				if want == nil {
+					require.NoError(t, err)
+					assert.Equal(t, "1.", r.RequestLine.HttpVersion[:2])
+				} else {
+					require.ErrorIs(t, err, want)
+				}
+			})
+		}
+	}
+}
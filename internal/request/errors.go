@@ -0,0 +1,48 @@
+package request
+
+import (
+	"errors"
+	"fmt"
+)
+
+// The errors a ParseError wraps, they tell what part of the request was wrong
+var (
+	ErrMalformedRequestLine        = errors.New("malformed request-line")
+	ErrInvalidMethod               = errors.New("invalid method")
+	ErrInvalidTarget               = errors.New("invalid request-target")
+	ErrInvalidVersion              = errors.New("invalid HTTP version")
+	ErrUnsupportedVersion          = errors.New("unsupported HTTP version")
+	ErrMalformedHeader             = errors.New("malformed header field")
+	ErrInvalidHost                 = errors.New("invalid Host header")
+	ErrInvalidContentLength        = errors.New("invalid Content-Length")
+	ErrInvalidTransferEncoding     = errors.New("invalid Transfer-Encoding")
+	ErrUnsupportedTransferEncoding = errors.New("unsupported Transfer-Encoding")
+	ErrAmbiguousFraming            = errors.New("ambiguous message framing")
+	ErrMalformedChunk              = errors.New("malformed chunked body")
+	ErrUnexpectedEOF               = errors.New("unexpected EOF")
+)
+
+// ParseError is returned when a request can't be parsed, or can't be read, in
+// which case Err wraps the error of the underlying reader. Offset is the
+// position of the offending byte, counted from the first byte of the request.
+type ParseError struct {
+	Offset int
+	Err    error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("error parsing the request at byte %d: %v", e.Offset, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// parseErrorf returns a ParseError at offset wrapping err, a sentinel that the
+// formatted details are appended to
+func parseErrorf(offset int, err error, format string, a ...any) *ParseError {
+	return &ParseError{
+		Offset: offset,
+		Err:    fmt.Errorf("%w: %s", err, fmt.Sprintf(format, a...)),
+	}
+}
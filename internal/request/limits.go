@@ -0,0 +1,53 @@
+package request
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Limits bound the size of a request, so that a client can't make the parser
+// buffer an arbitrary amount of data. A zero value disables that limit.
+type Limits struct {
+	// MaxRequestLineBytes is the longest request-line accepted, CRLF excluded
+	MaxRequestLineBytes int
+	// MaxHeaderBytes is the size of the whole header section, the trailer
+	// section counting towards it too
+	MaxHeaderBytes int
+	// MaxHeaderCount is the number of header (and trailer) field lines
+	MaxHeaderCount int
+	// MaxBodyBytes is the size of the body, after removing the chunked encoding
+	MaxBodyBytes int
+}
+
+var DefaultLimits = Limits{
+	MaxRequestLineBytes: 8 << 10,
+	MaxHeaderBytes:      64 << 10,
+	MaxHeaderCount:      100,
+	MaxBodyBytes:        10 << 20,
+}
+
+var (
+	ErrRequestLineTooLong = errors.New("request-line too long")
+	ErrHeadersTooLarge    = errors.New("header section too large")
+	ErrBodyTooLarge       = errors.New("body too large")
+)
+
+// LimitError is returned when a request exceeds one of its Limits. It wraps
+// ErrRequestLineTooLong, ErrHeadersTooLarge or ErrBodyTooLarge.
+type LimitError struct {
+	Err   error
+	Limit int
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("error: %v, the limit is %d", e.Err, e.Limit)
+}
+
+func (e *LimitError) Unwrap() error {
+	return e.Err
+}
+
+// exceeds reports whether size is above limit, a zero limit being unlimited
+func exceeds(size, limit int) bool {
+	return limit > 0 && size > limit
+}
@@ -2,8 +2,10 @@ package request
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
+	"math"
 	"strconv"
 	"strings"
 
@@ -13,13 +15,51 @@ import (
 type Request struct {
 	RequestLine RequestLine
 	ParserState int
-	Headers     headers.Headers
-	Body        []byte
+	Headers     *headers.Headers
+	// Body streams the body from the connection as it is read, with the
+	// chunked encoding removed. It is empty if the request has no body.
+	Body io.Reader
+	// Trailers holds the trailer fields sent after a chunked body, they are
+	// only set once Body has been read to its end
+	Trailers *headers.Headers
+
+	body           *body
+	expectContinue bool
+	continueHook   func() error
+	pending        []byte            // decoded body bytes not read from Body yet
+	bodyRead       int               // decoded body bytes parsed so far
+	contentLength  int               // of a body framed by Content-Length
+	chunkRemaining int               // bytes of the current chunk still to be read
+	pathValues     map[string]string // set by the router from the matched pattern
+	query          map[string][]string
+
+	limits      Limits
+	lenient     bool
+	parsed      int // bytes of the request parsed so far, for error offsets
+	headerBytes int // bytes of the header and trailer sections parsed so far
+	headerCount int // field lines of the header and trailer sections parsed so far
+}
+
+// PathValue returns the value of the named wildcard of the route pattern that
+// matched the request, or an empty string if there is none
+func (r *Request) PathValue(name string) string {
+	return r.pathValues[name]
+}
+
+// SetPathValue sets name to value, so that PathValue(name) returns it
+func (r *Request) SetPathValue(name, value string) {
+	if r.pathValues == nil {
+		r.pathValues = map[string]string{}
+	}
+	r.pathValues[name] = value
 }
 
 type RequestLine struct {
-	HttpVersion   string
+	HttpVersion string
+	// RequestTarget is the request-target as it was sent, Target is its
+	// parsed form
 	RequestTarget string
+	Target        Target
 	Method        string
 }
 
@@ -28,71 +68,174 @@ const (
 	requestStateDone
 	requestStateParsingHeaders
 	requestStateParsingBody
+	requestStateParsingChunkSize
+	requestStateParsingChunkData
+	requestStateParsingChunkDataEnd
+	requestStateParsingTrailers
 )
 
 const bufferSize int = 8
 
+// Reader reads consecutive requests from a single connection. Bytes read past
+// the end of one request (e.g. pipelined requests sent back-to-back) are kept in
+// its buffer and parsed as the beginning of the next one.
+type Reader struct {
+	reader      io.Reader
+	buf         []byte
+	readToIndex int
+
+	// Limits applies to every request read, it is DefaultLimits for a new Reader
+	Limits Limits
+	// Lenient relaxes the request-line grammar for legacy clients: its parts
+	// may be separated by any run of whitespace, the target may contain
+	// non-ASCII bytes, field values may contain obs-text, and HTTP/1.1
+	// requests may omit the Host header
+	Lenient bool
+
+	current *Request // the last request read, whose body may not be read yet
+}
+
+func NewReader(reader io.Reader) *Reader {
+	return &Reader{
+		reader: reader,
+		buf:    make([]byte, bufferSize, bufferSize),
+		Limits: DefaultLimits,
+	}
+}
+
+// WaitForRequest blocks until the next request starts arriving, i.e. until at
+// least one of its bytes has been read. It returns io.EOF if the peer closed
+// the connection instead.
+func (r *Reader) WaitForRequest() error {
+	for r.readToIndex == 0 {
+		bytesRead, err := r.reader.Read(r.buf)
+		r.readToIndex += bytesRead
+		if err != nil && bytesRead == 0 {
+			return err
+		}
+	}
+	return nil
+}
+
+// RequestFromReader reads a whole request, its body included, which is meant
+// for small requests: Body then reads from memory.
 func RequestFromReader(reader io.Reader) (*Request, error) {
-	buf := make([]byte, bufferSize, bufferSize)
+	req, err := NewReader(reader).ReadRequest()
+	if err != nil {
+		return nil, err
+	}
+	data, err := req.ReadBody()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = bytes.NewReader(data)
+	return req, nil
+}
+
+// ReadRequest parses the request-line and headers of the next request,
+// starting with any bytes left over from the previous one. Its body is read
+// from the connection as Body is read. Whatever the previous request left of
+// its body is discarded first.
+func (r *Reader) ReadRequest() (*Request, error) {
+	if r.current != nil {
+		if _, err := io.Copy(io.Discard, r.current.body); err != nil {
+			return nil, err
+		}
+	}
+
 	req := &Request{
 		ParserState: requestStateInitialized,
-		Headers:     headers.Headers{},
+		Headers:     headers.NewHeaders(),
+		Trailers:    headers.NewHeaders(),
+		limits:      r.Limits,
+		lenient:     r.Lenient,
 	}
-	readToIndex := 0
-	for req.ParserState != requestStateDone {
-		// read into the buffer
-		bytesRead, err := reader.Read(buf[readToIndex:])
+	req.body = &body{reader: r, req: req, done: make(chan struct{})}
+	req.Body = req.body
 
-		if err != nil {
-			if err == io.EOF {
-				// if EOF is reached while parsing the body, ensure Content-Length has been satisfied
-				if req.ParserState == requestStateParsingBody {
-					if contentLengthStr, ok := req.Headers["content-length"]; ok {
-						contentLengthNumber, err := strconv.Atoi(contentLengthStr)
-						if err != nil {
-							return nil, fmt.Errorf("invalid Content-Length: %v", err)
-						}
-						if len(req.Body) < contentLengthNumber {
-							return nil, fmt.Errorf("unexpected EOF: body shorter than Content-Length header")
-						}
-					}
-				}
-				req.ParserState = requestStateDone
-				break
-			}
-			return nil, fmt.Errorf("error reading: %v", err)
+	// a pipelined request may already be sitting in the buffer
+	if err := r.parseBuffered(req); err != nil {
+		return nil, err
+	}
+	for !req.headersDone() {
+		if err := r.fill(req); err != nil {
+			return nil, err
 		}
-		if bytesRead > 0 {
-			readToIndex += bytesRead
+	}
+	if req.ParserState == requestStateDone {
+		// there is no body to wait for
+		req.body.finish(io.EOF)
+	} else {
+		// HTTP/1.0 clients don't know about 100 Continue, the expectation is ignored
+		req.expectContinue = req.RequestLine.HttpVersion == "1.1" && strings.EqualFold(req.Headers.Get("Expect"), "100-continue")
+	}
+	r.current = req
+	return req, nil
+}
 
-			// parse from the buffer
-			parsedBytes, err := req.parse(buf[:readToIndex])
-			if err != nil {
-				return nil, fmt.Errorf("error parsing the request-line: %v", err)
-			}
-			if parsedBytes > 0 {
-				copy(buf, buf[parsedBytes:readToIndex])
-				readToIndex -= parsedBytes
-			}
-			if readToIndex == len(buf) {
-				newBuf := make([]byte, 2*len(buf))
-				copy(newBuf, buf)
-				buf = newBuf
+// fill reads more bytes from the connection into the buffer and parses them
+func (r *Reader) fill(req *Request) error {
+	bytesRead, err := r.reader.Read(r.buf[r.readToIndex:])
+	if err != nil {
+		// the offset of the missing byte
+		end := req.parsed + r.readToIndex
+		if err != io.EOF {
+			// e.g. a read deadline, which the server tells apart from the
+			// errors a handler returns by the ParseError
+			return &ParseError{Offset: end, Err: fmt.Errorf("error reading: %w", err)}
+		}
+		switch {
+		case req.ParserState == requestStateInitialized:
+			// the peer closed the connection before sending another request
+			if r.readToIndex == 0 {
+				return io.EOF
 			}
+			return parseErrorf(end, ErrUnexpectedEOF, "incomplete request-line")
+		case req.ParserState == requestStateParsingHeaders:
+			// the Host and framing checks only run at the end of the section
+			return parseErrorf(end, ErrUnexpectedEOF, "incomplete header section")
+		case req.ParserState == requestStateParsingBody:
+			return parseErrorf(end, ErrUnexpectedEOF, "body shorter than Content-Length header")
+		case req.isParsingChunkedBody():
+			return parseErrorf(end, ErrUnexpectedEOF, "chunked body is incomplete")
 		}
+		req.ParserState = requestStateDone
+		return nil
+	}
+	if bytesRead > 0 {
+		r.readToIndex += bytesRead
+		return r.parseBuffered(req)
 	}
+	return nil
+}
 
-	return req, nil
+// parseBuffered feeds the unparsed bytes of the buffer to req, keeping whatever
+// it did not consume for the next call
+func (r *Reader) parseBuffered(req *Request) error {
+	parsedBytes, err := req.parse(r.buf[:r.readToIndex])
+	if err != nil {
+		return err
+	}
+	if parsedBytes > 0 {
+		copy(r.buf, r.buf[parsedBytes:r.readToIndex])
+		r.readToIndex -= parsedBytes
+	}
+	if r.readToIndex == len(r.buf) {
+		newBuf := make([]byte, 2*len(r.buf))
+		copy(newBuf, r.buf)
+		r.buf = newBuf
+	}
+	return nil
 }
 
-func parseRequestLine(data []byte) (*RequestLine, int, error) {
+func parseRequestLine(data []byte, lenient bool) (*RequestLine, int, error) {
 	idx := bytes.Index(data, []byte("\r\n"))
 	if idx == -1 {
 		// return nil, 0, fmt.Errorf("could not find CLRF in request-line")
 		return nil, 0, nil
 	}
 	requestLineString := string(data[:idx])
-	requestLine, err := requestLineFromString(requestLineString)
+	requestLine, err := requestLineFromString(requestLineString, lenient)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -100,59 +243,132 @@ func parseRequestLine(data []byte) (*RequestLine, int, error) {
 	return requestLine, idx + 2, nil
 }
 
-func requestLineFromString(str string) (*RequestLine, error) {
-	rlParts := strings.Split(str, " ")
+// requestLineFromString parses a request-line, the offsets of its errors are
+// relative to the start of the line
+func requestLineFromString(str string, lenient bool) (*RequestLine, error) {
+	rlParts, offsets := splitRequestLine(str, lenient)
 	if len(rlParts) != 3 {
-		return nil, fmt.Errorf("poorly formatted request-line: %s", str)
+		return nil, parseErrorf(0, ErrMalformedRequestLine, "%q", str)
 	}
 	method := rlParts[0]
 	target := rlParts[1]
 	version := rlParts[2]
+	versionOffset := offsets[2]
 
-	// check method
-	for _, ch := range method {
-		if ch < 'A' || ch > 'Z' {
-			return nil, fmt.Errorf("invalid method name: %s", method)
-		}
+	// check method, a case-sensitive token
+	if i := strings.IndexFunc(method, func(c rune) bool { return !headers.IsToken(string(c)) }); i != -1 {
+		return nil, parseErrorf(offsets[0]+i, ErrInvalidMethod, "%q", method)
 	}
 
-	// check HTTP-version
-	versionParts := strings.Split(version, "/")
-	if versionParts[0] != "HTTP" {
-		return nil, fmt.Errorf("invalid HTTP version: %s", versionParts[0])
+	// check HTTP-version, a well-formed version other than 1.0 and 1.1 (e.g.
+	// the HTTP/2 connection preface "PRI * HTTP/2.0") is unsupported, not invalid
+	name, number, ok := strings.Cut(version, "/")
+	if !ok || name != "HTTP" || !isVersionNumber(number) {
+		return nil, parseErrorf(versionOffset, ErrInvalidVersion, "%q", version)
 	}
-	if versionParts[1] != "1.1" {
-		return nil, fmt.Errorf("invalid HTTP version: %s", versionParts[1])
+	if number != "1.1" && number != "1.0" {
+		return nil, parseErrorf(versionOffset+len("HTTP/"), ErrUnsupportedVersion, "%q", version)
+	}
+
+	parsedTarget, parseErr := parseTarget(method, target, lenient)
+	if parseErr != nil {
+		parseErr.Offset += offsets[1]
+		return nil, parseErr
 	}
 
 	return &RequestLine{
 		Method:        method,
 		RequestTarget: target,
-		HttpVersion:   versionParts[1],
+		Target:        parsedTarget,
+		HttpVersion:   number,
 	}, nil
 }
 
+// splitRequestLine splits a request-line in its parts and returns their
+// offsets. Parts are separated by a single space, or in lenient mode by any
+// run of whitespace (RFC 9112 section 3), empty parts being malformed.
+func splitRequestLine(str string, lenient bool) ([]string, []int) {
+	parts := []string{}
+	offsets := []int{}
+	if !lenient {
+		offset := 0
+		for _, part := range strings.Split(str, " ") {
+			if part == "" {
+				return nil, nil
+			}
+			parts = append(parts, part)
+			offsets = append(offsets, offset)
+			offset += len(part) + 1
+		}
+		return parts, offsets
+	}
+
+	start := -1
+	for i := 0; i <= len(str); i++ {
+		isSpace := i == len(str) || strings.IndexByte(" \t\v\f\r", str[i]) != -1
+		if isSpace && start != -1 {
+			parts = append(parts, str[start:i])
+			offsets = append(offsets, start)
+			start = -1
+		} else if !isSpace && start == -1 {
+			start = i
+		}
+	}
+	return parts, offsets
+}
+
+// isVersionNumber reports whether s is a version number, i.e. a digit, a dot
+// and a digit
+func isVersionNumber(s string) bool {
+	return len(s) == 3 && s[0] >= '0' && s[0] <= '9' && s[1] == '.' && s[2] >= '0' && s[2] <= '9'
+}
+
+// parse consumes as much of data as it can, stopping at the end of the header
+// section so that the request can be handed over before its body is read
 func (r *Request) parse(data []byte) (int, error) {
+	headersDone := r.headersDone()
 	totalBytesParsed := 0
 	for r.ParserState != requestStateDone {
 		n, err := r.parseSingle(data[totalBytesParsed:])
 		if err != nil {
-			return 0, err
-		} else if n == 0 {
-			return totalBytesParsed, nil
+			return 0, r.parseError(totalBytesParsed, err)
 		}
 		totalBytesParsed += n
+		if n == 0 || (!headersDone && r.headersDone()) {
+			break
+		}
 	}
+	r.parsed += totalBytesParsed
 	return totalBytesParsed, nil
 }
 
+// parseError turns an error of parseSingle, whose offset is relative to the
+// data it was given, into a ParseError with an offset relative to the request
+func (r *Request) parseError(dataOffset int, err error) *ParseError {
+	parseErr := &ParseError{}
+	if errors.As(err, &parseErr) {
+		parseErr.Offset += r.parsed + dataOffset
+		return parseErr
+	}
+	return &ParseError{Offset: r.parsed + dataOffset, Err: err}
+}
+
 func (r *Request) parseSingle(data []byte) (int, error) {
 	switch r.ParserState {
 	case requestStateInitialized:
-		requestLine, n, err := parseRequestLine(data)
+		// empty lines before the request-line are ignored (RFC 9112 section 2.2)
+		if bytes.HasPrefix(data, []byte("\r\n")) {
+			return 2, nil
+		}
+		requestLine, n, err := parseRequestLine(data, r.lenient)
 		if err != nil {
 			return 0, err
-		} else if n == 0 {
+		}
+		// n includes the CRLF, without one the whole data is part of the line
+		if (n == 0 && exceeds(len(data), r.limits.MaxRequestLineBytes)) || exceeds(n-2, r.limits.MaxRequestLineBytes) {
+			return 0, &LimitError{Err: ErrRequestLineTooLong, Limit: r.limits.MaxRequestLineBytes}
+		}
+		if n == 0 {
 			return 0, nil
 		}
 		r.RequestLine = *requestLine
@@ -161,32 +377,247 @@ func (r *Request) parseSingle(data []byte) (int, error) {
 	case requestStateDone:
 		return 0, fmt.Errorf("error: trying to read data in a requestStateDone state")
 	case requestStateParsingHeaders:
-		n, done, err := r.Headers.Parse(data)
+		n, done, err := r.parseFieldLine(r.Headers, data)
 		if err != nil {
 			return 0, err
 		}
 		if done {
-			r.ParserState = requestStateParsingBody
-		}
-		return n, nil
-	case requestStateParsingBody:
-		contentLength, ok := r.Headers["content-length"]
-		if ok {
-			contentLengthNumber, err := strconv.Atoi(contentLength)
-			if err != nil {
+			if err := r.checkHost(); err != nil {
 				return 0, err
 			}
-			r.Body = append(r.Body, data...)
-			if len(r.Body) > contentLengthNumber {
-				return 0, fmt.Errorf("error: the length of the body is greater than the Content-Length header")
-			} else if len(r.Body) == contentLengthNumber {
-				r.ParserState = requestStateDone
+			if err := r.startBody(n); err != nil {
+				return 0, err
 			}
+		}
+		return n, nil
+	case requestStateParsingBody:
+		if len(data) == 0 {
+			return 0, nil
+		}
+		// only consume the bytes that belong to this message's body
+		n := min(r.contentLength-r.bodyRead, len(data))
+		r.pending = append(r.pending, data[:n]...)
+		r.bodyRead += n
+		if r.bodyRead == r.contentLength {
+			r.ParserState = requestStateDone
+		}
+		return n, nil
+	case requestStateParsingChunkSize:
+		idx := bytes.Index(data, []byte("\r\n"))
+		// chunk extensions could otherwise make the line, and the buffer
+		// waiting for its end, grow without bound
+		if idx > maxChunkSizeLineBytes || (idx == -1 && len(data) > maxChunkSizeLineBytes) {
+			return 0, parseErrorf(0, ErrMalformedChunk, "chunk-size line longer than %d bytes", maxChunkSizeLineBytes)
+		}
+		if idx == -1 {
+			return 0, nil
+		}
+		size, err := parseChunkSize(string(data[:idx]))
+		if err != nil {
+			return 0, err
+		}
+		if exceeds(r.bodyRead+size, r.limits.MaxBodyBytes) {
+			return 0, &LimitError{Err: ErrBodyTooLarge, Limit: r.limits.MaxBodyBytes}
+		}
+		if size == 0 {
+			// the last chunk, only the trailer section is left
+			r.ParserState = requestStateParsingTrailers
 		} else {
+			r.chunkRemaining = size
+			r.ParserState = requestStateParsingChunkData
+		}
+		return idx + 2, nil
+	case requestStateParsingChunkData:
+		if len(data) == 0 {
+			return 0, nil
+		}
+		n := min(r.chunkRemaining, len(data))
+		r.pending = append(r.pending, data[:n]...)
+		r.bodyRead += n
+		r.chunkRemaining -= n
+		if r.chunkRemaining == 0 {
+			r.ParserState = requestStateParsingChunkDataEnd
+		}
+		return n, nil
+	case requestStateParsingChunkDataEnd:
+		if len(data) < 2 {
+			return 0, nil
+		}
+		if !bytes.HasPrefix(data, []byte("\r\n")) {
+			return 0, parseErrorf(0, ErrMalformedChunk, "chunk data is not followed by a CRLF")
+		}
+		r.ParserState = requestStateParsingChunkSize
+		return 2, nil
+	case requestStateParsingTrailers:
+		n, done, err := r.parseFieldLine(r.Trailers, data)
+		if err != nil {
+			return 0, err
+		}
+		if done {
 			r.ParserState = requestStateDone
 		}
-		return len(data), nil
+		return n, nil
 	default:
 		return 0, fmt.Errorf("error unknown state: %v", r.ParserState)
 	}
 }
+
+// checkHost makes sure an HTTP/1.1 request has a single Host header, which
+// the server must answer with a 400 otherwise (RFC 9112 section 3.2)
+func (r *Request) checkHost() error {
+	if r.lenient || r.RequestLine.HttpVersion != "1.1" {
+		return nil
+	}
+	hosts := r.Headers.Values("Host")
+	if len(hosts) == 0 {
+		return parseErrorf(0, ErrInvalidHost, "missing Host header")
+	}
+	// a host can't contain a comma, so one in the value is a list of hosts
+	if len(hosts) > 1 || strings.Contains(hosts[0], ",") {
+		return parseErrorf(0, ErrInvalidHost, "multiple Host headers: %q", strings.Join(hosts, ", "))
+	}
+	return nil
+}
+
+// startBody picks how the body is framed once the headers are parsed, its
+// errors are reported at offset, the start of the body
+func (r *Request) startBody(offset int) error {
+	// the framing decides where the next request starts, so anything that
+	// two parsers could read differently is rejected (RFC 9112 section 6.3)
+	// repeated fields are read as a single comma-separated list
+	chunked := r.Headers.Has("Transfer-Encoding")
+	transferEncoding := strings.Join(r.Headers.Values("Transfer-Encoding"), ", ")
+	ok := r.Headers.Has("Content-Length")
+	contentLength := strings.Join(r.Headers.Values("Content-Length"), ", ")
+	if chunked {
+		if ok {
+			return parseErrorf(offset, ErrAmbiguousFraming, "both Transfer-Encoding and Content-Length are set")
+		}
+		if err := checkTransferEncoding(r.RequestLine.HttpVersion, transferEncoding); err != nil {
+			return parseErrorf(offset, err, "%q", transferEncoding)
+		}
+		r.ParserState = requestStateParsingChunkSize
+		return nil
+	}
+	if !ok {
+		// without a Content-Length the message has no body, anything after
+		// the headers belongs to the next request on the connection
+		r.ParserState = requestStateDone
+		return nil
+	}
+	contentLengthNumber, err := r.Headers.ContentLength()
+	if err != nil {
+		return parseErrorf(offset, ErrInvalidContentLength, "%q", contentLength)
+	}
+	// refuse the body before reading any of it
+	if exceeds(contentLengthNumber, r.limits.MaxBodyBytes) {
+		return &ParseError{Offset: offset, Err: &LimitError{Err: ErrBodyTooLarge, Limit: r.limits.MaxBodyBytes}}
+	}
+	r.contentLength = contentLengthNumber
+	r.ParserState = requestStateParsingBody
+	if contentLengthNumber == 0 {
+		r.ParserState = requestStateDone
+	}
+	return nil
+}
+
+// checkTransferEncoding returns the error for a Transfer-Encoding the body
+// can't be read with, chunked being the only coding supported and the one
+// that must come last
+func checkTransferEncoding(httpVersion, transferEncoding string) error {
+	if httpVersion == "1.0" {
+		// HTTP/1.0 has no transfer codings, the framing is faulty
+		return ErrInvalidTransferEncoding
+	}
+	codings := strings.Split(transferEncoding, ",")
+	for i, coding := range codings {
+		coding = strings.ToLower(strings.Trim(coding, " \t"))
+		last := i == len(codings)-1
+		// chunked must be the last coding, and only that one
+		if (coding == "chunked") != last {
+			return ErrInvalidTransferEncoding
+		}
+		if coding != "chunked" {
+			return ErrUnsupportedTransferEncoding
+		}
+	}
+	return nil
+}
+
+// parseFieldLine parses a single header or trailer field line into h,
+// enforcing the header size and count limits
+func (r *Request) parseFieldLine(h *headers.Headers, data []byte) (int, bool, error) {
+	if len(data) > 0 && (data[0] == ' ' || data[0] == '\t') {
+		// either whitespace before the first field, or obs-fold continuing
+		// the previous field on a new line, both are rejected (RFC 9112
+		// sections 2.2 and 5.2)
+		return 0, false, parseErrorf(0, ErrMalformedHeader, "line starting with whitespace (obs-fold)")
+	}
+	if end := bytes.Index(data, []byte(headers.CLRF)); end != -1 && !r.lenient {
+		// obs-text is allowed in field values for compatibility only, it is
+		// rejected like non-ASCII bytes in the request-target
+		for i := 0; i < end; i++ {
+			if data[i] >= 0x80 {
+				return 0, false, parseErrorf(i, ErrMalformedHeader, "non-ASCII byte (obs-text) in %q", data[:end])
+			}
+		}
+	}
+	n, done, err := h.Parse(data)
+	if err != nil {
+		return 0, false, &ParseError{Err: fmt.Errorf("%w: %w", ErrMalformedHeader, err)}
+	}
+	// an incomplete line still counts, so it can't grow past the limit
+	size := r.headerBytes + n
+	if n == 0 {
+		size += len(data)
+	}
+	if exceeds(size, r.limits.MaxHeaderBytes) {
+		return 0, false, &LimitError{Err: ErrHeadersTooLarge, Limit: r.limits.MaxHeaderBytes}
+	}
+	r.headerBytes += n
+	if n > 0 && !done {
+		r.headerCount++
+		if exceeds(r.headerCount, r.limits.MaxHeaderCount) {
+			return 0, false, &LimitError{Err: ErrHeadersTooLarge, Limit: r.limits.MaxHeaderCount}
+		}
+	}
+	return n, done, nil
+}
+
+// headersDone reports whether the parser got past the header section
+func (r *Request) headersDone() bool {
+	return r.ParserState != requestStateInitialized && r.ParserState != requestStateParsingHeaders
+}
+
+func (r *Request) isParsingChunkedBody() bool {
+	switch r.ParserState {
+	case requestStateParsingChunkSize, requestStateParsingChunkData, requestStateParsingChunkDataEnd, requestStateParsingTrailers:
+		return true
+	}
+	return false
+}
+
+// maxChunkSizeLineBytes is the longest chunk-size line accepted, extensions
+// included and CRLF excluded
+const maxChunkSizeLineBytes = 4096
+
+// parseChunkSize parses a chunk-size line, i.e. the size in hexadecimal
+// optionally followed by chunk extensions, which are ignored
+func parseChunkSize(line string) (int, error) {
+	sizeStr, _, _ := strings.Cut(line, ";")
+	sizeStr = strings.TrimRight(sizeStr, " \t")
+	if len(sizeStr) == 0 {
+		return 0, parseErrorf(0, ErrMalformedChunk, "missing chunk size in %q", line)
+	}
+	for i, c := range sizeStr {
+		isHexDigit := (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+		if !isHexDigit {
+			return 0, parseErrorf(i, ErrMalformedChunk, "invalid chunk size %q", sizeStr)
+		}
+	}
+	size, err := strconv.ParseInt(sizeStr, 16, 64)
+	if err != nil || size > math.MaxInt32 {
+		return 0, parseErrorf(0, ErrMalformedChunk, "chunk size too large: %q", sizeStr)
+	}
+	return int(size), nil
+}
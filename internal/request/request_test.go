@@ -34,6 +34,23 @@ func (cr *chunkReader) Read(p []byte) (n int, err error) {
 	return n, nil
 }
 
+// endlessReader reads as an endless stream of the same byte
+type endlessReader byte
+
+func (e endlessReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = byte(e)
+	}
+	return len(p), nil
+}
+
+// readBody reads the rest of the body of r
+func readBody(t *testing.T, r *Request) string {
+	data, err := r.ReadBody()
+	require.NoError(t, err)
+	return string(data)
+}
+
 func TestRequestLineParse(t *testing.T) {
 	// Test: Good GET Request line
 	r, err := RequestFromReader(strings.NewReader("GET / HTTP/1.1\r\nHost: localhost:42069\r\nUser-Agent: curl/7.81.0\r\nAccept: */*\r\n\r\n"))
@@ -96,6 +113,26 @@ func TestRequestLineParse(t *testing.T) {
 	assert.Equal(t, "1.1", r.RequestLine.HttpVersion)
 }
 
+func TestHTTPVersions(t *testing.T) {
+	// Test: HTTP/1.0 without a Host header
+	r, err := RequestFromReader(strings.NewReader("GET /coffee HTTP/1.0\r\nExpect: 100-continue\r\nContent-Length: 2\r\n\r\nhi"))
+	require.NoError(t, err)
+	assert.Equal(t, "1.0", r.RequestLine.HttpVersion)
+	assert.False(t, r.ExpectsContinue())
+
+	// Test: malformed versions are rejected without panicking
+	for _, version := range []string{"HTTP", "HTTP/", "HTTP/1", "HTTP/1.1.1", "HTTP/a.b", "http/1.1"} {
+		_, err = RequestFromReader(strings.NewReader("GET / " + version + "\r\n\r\n"))
+		require.ErrorIs(t, err, ErrInvalidVersion, version)
+	}
+
+	// Test: well-formed but unsupported versions, e.g. the HTTP/2 preface
+	for _, line := range []string{"GET / HTTP/2.0", "GET / HTTP/1.2", "GET / HTTP/0.9", "PRI * HTTP/2.0"} {
+		_, err = RequestFromReader(strings.NewReader(line + "\r\n\r\nSM\r\n\r\n"))
+		require.ErrorIs(t, err, ErrUnsupportedVersion, line)
+	}
+}
+
 func TestRequestHeaderParse(t *testing.T) {
 	// Test: Standard Headers
 	reader := &chunkReader{
@@ -105,9 +142,9 @@ func TestRequestHeaderParse(t *testing.T) {
 	r, err := RequestFromReader(reader)
 	require.NoError(t, err)
 	require.NotNil(t, r)
-	assert.Equal(t, "localhost:42069", r.Headers["host"])
-	assert.Equal(t, "curl/7.81.0", r.Headers["user-agent"])
-	assert.Equal(t, "*/*", r.Headers["accept"])
+	assert.Equal(t, "localhost:42069", r.Headers.Get("host"))
+	assert.Equal(t, "curl/7.81.0", r.Headers.Get("user-agent"))
+	assert.Equal(t, "*/*", r.Headers.Get("accept"))
 
 	// Test: Malformed Header
 	reader = &chunkReader{
@@ -127,13 +164,21 @@ func TestRequestHeaderParse(t *testing.T) {
 
 	// Test: Duplicate Headers
 	reader = &chunkReader{
-		data:            "GET / HTTP/1.1\r\nHost: localhost:42069\r\nHost: nacho.com\r\n",
+		data:            "GET / HTTP/1.1\r\nHost: localhost:42069\r\nAccept: text/html\r\nAccept: application/json\r\n\r\n",
 		numBytesPerRead: 8,
 	}
 	r, err = RequestFromReader(reader)
 	require.NoError(t, err)
 	require.NotNil(t, r)
-	assert.Equal(t, "localhost:42069, nacho.com", r.Headers["host"])
+	assert.Equal(t, []string{"text/html", "application/json"}, r.Headers.Values("accept"))
+
+	// Test: Duplicate Host, which is rejected
+	reader = &chunkReader{
+		data:            "GET / HTTP/1.1\r\nHost: localhost:42069\r\nHost: nacho.com\r\n\r\n",
+		numBytesPerRead: 8,
+	}
+	r, err = RequestFromReader(reader)
+	require.ErrorIs(t, err, ErrInvalidHost)
 
 	// Test: Case Insensitive header
 	reader = &chunkReader{
@@ -143,9 +188,9 @@ func TestRequestHeaderParse(t *testing.T) {
 	r, err = RequestFromReader(reader)
 	require.NoError(t, err)
 	require.NotNil(t, r)
-	assert.Equal(t, "localhost:42069", r.Headers["host"])
-	assert.Equal(t, "curl/7.81.0", r.Headers["user-agent"])
-	assert.Equal(t, "*/*", r.Headers["accept"])
+	assert.Equal(t, "localhost:42069", r.Headers.Get("host"))
+	assert.Equal(t, "curl/7.81.0", r.Headers.Get("user-agent"))
+	assert.Equal(t, "*/*", r.Headers.Get("accept"))
 
 }
 
@@ -162,7 +207,7 @@ func TestBodyParse(t *testing.T) {
 	r, err := RequestFromReader(reader)
 	require.NoError(t, err)
 	require.NotNil(t, r)
-	assert.Equal(t, "hello world!\n", string(r.Body))
+	assert.Equal(t, "hello world!\n", readBody(t, r))
 
 	// Test: Body shorter than reported content length
 	reader = &chunkReader{
@@ -188,7 +233,7 @@ func TestBodyParse(t *testing.T) {
 	r, err = RequestFromReader(reader)
 	require.NoError(t, err)
 	require.NotNil(t, r)
-	assert.Equal(t, "", string(r.Body))
+	assert.Equal(t, "", readBody(t, r))
 
 	// Test: empty body, no reported content length
 	reader = &chunkReader{
@@ -201,7 +246,7 @@ func TestBodyParse(t *testing.T) {
 	r, err = RequestFromReader(reader)
 	require.NoError(t, err)
 	require.NotNil(t, r)
-	assert.Equal(t, "", string(r.Body))
+	assert.Equal(t, "", readBody(t, r))
 
 	// Test: no content-length but body exists
 	reader = &chunkReader{
@@ -214,5 +259,370 @@ func TestBodyParse(t *testing.T) {
 	r, err = RequestFromReader(reader)
 	require.NoError(t, err)
 	require.NotNil(t, r)
-	assert.Equal(t, "", string(r.Body))
+	assert.Equal(t, "", readBody(t, r))
+}
+
+func TestRequestEndOfMessage(t *testing.T) {
+	// Test: body stops at Content-Length even if more bytes follow
+	reader := &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Content-Length: 5\r\n" +
+			"\r\n" +
+			"hello world!",
+		numBytesPerRead: 3,
+	}
+	r, err := RequestFromReader(reader)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.Equal(t, "hello", readBody(t, r))
+
+	// Test: connection closed before any request was sent
+	reader = &chunkReader{
+		data:            "",
+		numBytesPerRead: 3,
+	}
+	_, err = RequestFromReader(reader)
+	require.ErrorIs(t, err, io.EOF)
+
+	// Test: connection closed in the middle of the request-line
+	reader = &chunkReader{
+		data:            "GET /coff",
+		numBytesPerRead: 3,
+	}
+	_, err = RequestFromReader(reader)
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, io.EOF)
+}
+
+func TestPipelinedRequests(t *testing.T) {
+	// Test: three requests sent back-to-back in a single stream
+	reader := NewReader(&chunkReader{
+		data: "GET /first HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"\r\n" +
+			"POST /second HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Content-Length: 13\r\n" +
+			"\r\n" +
+			"hello world!\n" +
+			"GET /third HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Connection: close\r\n" +
+			"\r\n",
+		numBytesPerRead: 7,
+	})
+
+	r, err := reader.ReadRequest()
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.Equal(t, "GET", r.RequestLine.Method)
+	assert.Equal(t, "/first", r.RequestLine.RequestTarget)
+	assert.Equal(t, "", readBody(t, r))
+
+	r, err = reader.ReadRequest()
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.Equal(t, "POST", r.RequestLine.Method)
+	assert.Equal(t, "/second", r.RequestLine.RequestTarget)
+	assert.Equal(t, "hello world!\n", readBody(t, r))
+
+	r, err = reader.ReadRequest()
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.Equal(t, "GET", r.RequestLine.Method)
+	assert.Equal(t, "/third", r.RequestLine.RequestTarget)
+	assert.Equal(t, "close", r.Headers.Get("connection"))
+
+	_, err = reader.ReadRequest()
+	require.ErrorIs(t, err, io.EOF)
+
+	// Test: the whole pipeline arrives in a single read
+	reader = NewReader(&chunkReader{
+		data: "GET /a HTTP/1.1\r\nHost: localhost:42069\r\n\r\n" +
+			"GET /b HTTP/1.1\r\nHost: localhost:42069\r\n\r\n" +
+			"GET /c HTTP/1.1\r\nHost: localhost:42069\r\n\r\n",
+		numBytesPerRead: 1024,
+	})
+	for _, target := range []string{"/a", "/b", "/c"} {
+		r, err = reader.ReadRequest()
+		require.NoError(t, err)
+		require.NotNil(t, r)
+		assert.Equal(t, target, r.RequestLine.RequestTarget)
+	}
+	_, err = reader.ReadRequest()
+	require.ErrorIs(t, err, io.EOF)
+}
+
+func TestChunkedBodyParse(t *testing.T) {
+	// Test: chunked body
+	reader := &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"5\r\n" +
+			"hello\r\n" +
+			"8\r\n" +
+			" world!\n\r\n" +
+			"0\r\n" +
+			"\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err := RequestFromReader(reader)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.Equal(t, "hello world!\n", readBody(t, r))
+	assert.Empty(t, r.Trailers)
+
+	// Test: chunk extensions and uppercase hex sizes
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"A;name=value\r\n" +
+			"0123456789\r\n" +
+			"0;last\r\n" +
+			"\r\n",
+		numBytesPerRead: 5,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.Equal(t, "0123456789", readBody(t, r))
+
+	// Test: trailers are kept apart from the headers
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"Trailer: X-Checksum\r\n" +
+			"\r\n" +
+			"4\r\n" +
+			"data\r\n" +
+			"0\r\n" +
+			"X-Checksum: abc123\r\n" +
+			"\r\n",
+		numBytesPerRead: 4,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.Equal(t, "data", readBody(t, r))
+	assert.Equal(t, "abc123", r.Trailers.Get("X-Checksum"))
+	assert.Equal(t, "", r.Headers.Get("X-Checksum"))
+
+	// Test: invalid chunk size
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"zz\r\n" +
+			"data\r\n" +
+			"0\r\n" +
+			"\r\n",
+		numBytesPerRead: 4,
+	}
+	_, err = RequestFromReader(reader)
+	require.Error(t, err)
+
+	// Test: chunk data longer than its size
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"2\r\n" +
+			"data\r\n" +
+			"0\r\n" +
+			"\r\n",
+		numBytesPerRead: 4,
+	}
+	_, err = RequestFromReader(reader)
+	require.Error(t, err)
+
+	// Test: stream ends before the last chunk
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"4\r\n" +
+			"data\r\n",
+		numBytesPerRead: 4,
+	}
+	_, err = RequestFromReader(reader)
+	require.Error(t, err)
+
+	// Test: the request following a chunked body is left for the next read
+	connReader := NewReader(&chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"4\r\n" +
+			"data\r\n" +
+			"0\r\n" +
+			"\r\n" +
+			"GET /next HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"\r\n",
+		numBytesPerRead: 6,
+	})
+	r, err = connReader.ReadRequest()
+	require.NoError(t, err)
+	assert.Equal(t, "data", readBody(t, r))
+	r, err = connReader.ReadRequest()
+	require.NoError(t, err)
+	assert.Equal(t, "/next", r.RequestLine.RequestTarget)
+}
+
+func TestStreamingBody(t *testing.T) {
+	pr, pw := io.Pipe()
+	reader := NewReader(pr)
+	go pw.Write([]byte("POST /submit HTTP/1.1\r\n" +
+		"Host: localhost:42069\r\n" +
+		"Transfer-Encoding: chunked\r\n" +
+		"\r\n"))
+
+	// Test: the request is returned before any of its body was sent
+	r, err := reader.ReadRequest()
+	require.NoError(t, err)
+	assert.Equal(t, "localhost:42069", r.Headers.Get("Host"))
+
+	// Test: each chunk is readable as soon as it arrives
+	buf := make([]byte, 64)
+	go pw.Write([]byte("6\r\nhello \r\n"))
+	n, err := io.ReadAtLeast(r.Body, buf, 6)
+	require.NoError(t, err)
+	assert.Equal(t, "hello ", string(buf[:n]))
+	select {
+	case <-r.BodyDone():
+		t.Fatal("body done before its last chunk")
+	default:
+	}
+
+	go func() {
+		pw.Write([]byte("6\r\nworld!\r\n0\r\nX-Checksum: abc123\r\n\r\n" +
+			"GET /next HTTP/1.1\r\nHost: localhost:42069\r\n\r\n"))
+		pw.Close()
+	}()
+	assert.Equal(t, "world!", readBody(t, r))
+	assert.Equal(t, "abc123", r.Trailers.Get("X-Checksum"))
+	<-r.BodyDone()
+
+	r, err = reader.ReadRequest()
+	require.NoError(t, err)
+	assert.Equal(t, "/next", r.RequestLine.RequestTarget)
+	assert.Equal(t, "", readBody(t, r))
+
+	// Test: an unread body is skipped by the next ReadRequest
+	reader = NewReader(&chunkReader{
+		data: "POST /first HTTP/1.1\r\nHost: localhost:42069\r\nContent-Length: 13\r\n\r\nhello world!\n" +
+			"GET /second HTTP/1.1\r\nHost: localhost:42069\r\n\r\n",
+		numBytesPerRead: 5,
+	})
+	_, err = reader.ReadRequest()
+	require.NoError(t, err)
+	r, err = reader.ReadRequest()
+	require.NoError(t, err)
+	assert.Equal(t, "/second", r.RequestLine.RequestTarget)
+}
+
+func TestLimits(t *testing.T) {
+	limits := Limits{
+		MaxRequestLineBytes: 32,
+		MaxHeaderBytes:      64,
+		MaxHeaderCount:      2,
+		MaxBodyBytes:        8,
+	}
+	read := func(data string) (string, error) {
+		reader := NewReader(&chunkReader{data: data, numBytesPerRead: 3})
+		reader.Limits = limits
+		r, err := reader.ReadRequest()
+		if err != nil {
+			return "", err
+		}
+		body, err := r.ReadBody()
+		return string(body), err
+	}
+
+	// Test: within every limit
+	body, err := read("POST /submit HTTP/1.1\r\nHost: localhost:42069\r\nContent-Length: 8\r\n\r\nhello!\r\n")
+	require.NoError(t, err)
+	assert.Equal(t, "hello!\r\n", body)
+
+	// Test: request-line too long, even before its CRLF arrives
+	_, err = read("GET /" + strings.Repeat("a", 64))
+	require.ErrorIs(t, err, ErrRequestLineTooLong)
+	limitErr := &LimitError{}
+	require.ErrorAs(t, err, &limitErr)
+	assert.Equal(t, 32, limitErr.Limit)
+
+	// Test: header section too large
+	_, err = read("GET / HTTP/1.1\r\nHost: localhost:42069\r\nCookie: " + strings.Repeat("a", 64) + "\r\n\r\n")
+	require.ErrorIs(t, err, ErrHeadersTooLarge)
+
+	// Test: too many header fields
+	_, err = read("GET / HTTP/1.1\r\nHost: localhost:42069\r\nA: 1\r\nB: 2\r\n\r\n")
+	require.ErrorIs(t, err, ErrHeadersTooLarge)
+
+	// Test: Content-Length above the limit
+	_, err = read("POST /submit HTTP/1.1\r\nHost: localhost:42069\r\nContent-Length: 9\r\n\r\n")
+	require.ErrorIs(t, err, ErrBodyTooLarge)
+
+	// Test: chunked body growing above the limit
+	_, err = read("POST /submit HTTP/1.1\r\nHost: localhost:42069\r\nTransfer-Encoding: chunked\r\n\r\n" +
+		"5\r\nhello\r\n5\r\nworld\r\n0\r\n\r\n")
+	require.ErrorIs(t, err, ErrBodyTooLarge)
+
+	// Test: chunk-size line that never ends, its extension growing forever
+	endless := NewReader(io.MultiReader(
+		strings.NewReader("POST /submit HTTP/1.1\r\nHost: localhost:42069\r\nTransfer-Encoding: chunked\r\n\r\n5;x="),
+		endlessReader('a'),
+	))
+	r, err := endless.ReadRequest()
+	require.NoError(t, err)
+	_, err = r.ReadBody()
+	require.ErrorIs(t, err, ErrMalformedChunk)
+	assert.LessOrEqual(t, len(endless.buf), 4*maxChunkSizeLineBytes)
+
+	// Test: zero disables a limit
+	limits = Limits{}
+	_, err = read("GET /" + strings.Repeat("a", 64) + " HTTP/1.1\r\nHost: localhost:42069\r\n\r\n")
+	require.NoError(t, err)
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   string
+		err    error
+		offset int
+	}{
+		{"malformed request-line", "GET /\r\n\r\n", ErrMalformedRequestLine, 0},
+		{"invalid method", "G(T / HTTP/1.1\r\n\r\n", ErrInvalidMethod, 1},
+		{"invalid version", "GET / HTTQ/1.1\r\n\r\n", ErrInvalidVersion, 6},
+		{"unsupported version", "GET / HTTP/2.0\r\n\r\n", ErrUnsupportedVersion, 11},
+		{"malformed header", "GET / HTTP/1.1\r\nHost: localhost\r\nBad Header: 1\r\n\r\n", ErrMalformedHeader, 33},
+		{"invalid Content-Length", "POST / HTTP/1.1\r\nHost: h\r\nContent-Length: ten\r\n\r\n", ErrInvalidContentLength, 49},
+		{"malformed chunk", "POST / HTTP/1.1\r\nHost: h\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhelloXX", ErrMalformedChunk, 64},
+		{"truncated body", "POST / HTTP/1.1\r\nHost: h\r\nContent-Length: 10\r\n\r\nhello", ErrUnexpectedEOF, 53},
+		{"header section cut short", "GET / HTTP/1.1\r\nX: y\r\n", ErrUnexpectedEOF, 22},
+		{"duplicate Host cut short", "GET / HTTP/1.1\r\nHost: a\r\nHost: b\r\n", ErrUnexpectedEOF, 34},
+		{"ambiguous framing cut short", "POST / HTTP/1.1\r\nHost: h\r\nTransfer-Encoding: chunked\r\nContent-Length: 4\r\n", ErrUnexpectedEOF, 73},
+		{"field line cut short", "GET / HTTP/1.1\r\nHost: h\r\nX: y", ErrUnexpectedEOF, 29},
+		{"body too large", "POST / HTTP/1.1\r\nHost: h\r\nContent-Length: 99999999999\r\n\r\n", ErrBodyTooLarge, 57},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := RequestFromReader(&chunkReader{data: tt.data, numBytesPerRead: 3})
+			require.ErrorIs(t, err, tt.err)
+			parseErr := &ParseError{}
+			require.ErrorAs(t, err, &parseErr)
+			assert.Equal(t, tt.offset, parseErr.Offset)
+		})
+	}
 }
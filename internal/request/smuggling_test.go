@@ -0,0 +1,69 @@
+package request
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSmugglingPayloads feeds known request smuggling payloads to the parser,
+// each of them must be rejected instead of being split into requests
+func TestSmugglingPayloads(t *testing.T) {
+	const smuggled = "GET /admin HTTP/1.1\r\nHost: a\r\n\r\n"
+	tests := []struct {
+		name string
+		head string // the header section, the body and smuggled request follow
+		body string
+		err  error
+	}{
+		// CL.CL: two parsers picking different Content-Length headers
+		{"conflicting Content-Length", "Content-Length: 4\r\nContent-Length: 40\r\n", "abcd", ErrInvalidContentLength},
+		{"Content-Length list", "Content-Length: 4, 40\r\n", "abcd", ErrInvalidContentLength},
+		{"signed Content-Length", "Content-Length: +4\r\n", "abcd", ErrInvalidContentLength},
+		{"hexadecimal Content-Length", "Content-Length: 0x4\r\n", "abcd", ErrInvalidContentLength},
+		{"overflowing Content-Length", "Content-Length: 99999999999999999999999\r\n", "abcd", ErrInvalidContentLength},
+		// CL.TE and TE.CL: one parser using each header
+		{"Content-Length then chunked", "Content-Length: 5\r\nTransfer-Encoding: chunked\r\n", "0\r\n\r\n", ErrAmbiguousFraming},
+		{"chunked then Content-Length", "Transfer-Encoding: chunked\r\nContent-Length: 4\r\n", "5c\r\n", ErrAmbiguousFraming},
+		// TE.TE: a Transfer-Encoding only some parsers understand
+		{"non-final chunked", "Transfer-Encoding: chunked, identity\r\n", "0\r\n\r\n", ErrInvalidTransferEncoding},
+		{"duplicate Transfer-Encoding", "Transfer-Encoding: chunked\r\nTransfer-Encoding: identity\r\n", "0\r\n\r\n", ErrInvalidTransferEncoding},
+		{"chunked twice", "Transfer-Encoding: chunked, chunked\r\n", "0\r\n\r\n", ErrInvalidTransferEncoding},
+		{"misspelled chunked", "Transfer-Encoding: xchunked\r\n", "0\r\n\r\n", ErrInvalidTransferEncoding},
+		{"empty Transfer-Encoding", "Transfer-Encoding:\r\n", "0\r\n\r\n", ErrInvalidTransferEncoding},
+		{"space before the colon", "Transfer-Encoding : chunked\r\n", "0\r\n\r\n", ErrMalformedHeader},
+		{"obs-fold", "Transfer-Encoding:\r\n chunked\r\n", "0\r\n\r\n", ErrMalformedHeader},
+		{"bare LF in a field line", "X-Padding: a\nTransfer-Encoding: chunked\r\n", "0\r\n\r\n", ErrMalformedHeader},
+		{"obs-fold with tab", "X-Padding: a\r\n\tTransfer-Encoding: chunked\r\n", "0\r\n\r\n", ErrMalformedHeader},
+		{"unsupported coding", "Transfer-Encoding: gzip, chunked\r\n", "0\r\n\r\n", ErrUnsupportedTransferEncoding},
+		// chunk framing tricks
+		{"chunk size with leading space", "Transfer-Encoding: chunked\r\n", " 0\r\n\r\n", ErrMalformedChunk},
+		{"overflowing chunk size", "Transfer-Encoding: chunked\r\n", "10000000000000000\r\nx\r\n", ErrMalformedChunk},
+		{"bare LF after chunk size", "Transfer-Encoding: chunked\r\n", "1\nx\r\n0\r\n\r\n", ErrMalformedChunk},
+		{"chunk longer than its size", "Transfer-Encoding: chunked\r\n", "1\r\nxx\r\n0\r\n\r\n", ErrMalformedChunk},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := NewReader(&chunkReader{
+				data:            "POST / HTTP/1.1\r\nHost: a\r\n" + tt.head + "\r\n" + tt.body + smuggled,
+				numBytesPerRead: 7,
+			})
+			r, err := reader.ReadRequest()
+			if err == nil {
+				_, err = r.ReadBody()
+			}
+			require.ErrorIs(t, err, tt.err)
+		})
+	}
+
+	// Test: Transfer-Encoding in an HTTP/1.0 request
+	_, err := RequestFromReader(strings.NewReader("POST / HTTP/1.0\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n" + smuggled))
+	require.ErrorIs(t, err, ErrInvalidTransferEncoding)
+
+	// Test: identical duplicated Content-Length values are accepted
+	r, err := RequestFromReader(strings.NewReader("POST / HTTP/1.1\r\nHost: a\r\nContent-Length: 4\r\nContent-Length: 4\r\n\r\nabcd"))
+	require.NoError(t, err)
+	assert.Equal(t, "abcd", readBody(t, r))
+}
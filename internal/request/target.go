@@ -0,0 +1,196 @@
+package request
+
+import (
+	"net"
+	"net/url"
+	"strings"
+)
+
+// TargetForm is one of the four forms of request-target of RFC 9112 section 3.2
+type TargetForm int
+
+const (
+	// OriginForm is an absolute path and optional query, e.g. "/where?q=now"
+	OriginForm TargetForm = iota
+	// AbsoluteForm is a whole URI, sent to proxies, e.g. "http://www.example.org/pub"
+	AbsoluteForm
+	// AuthorityForm is the host and port of a CONNECT request, e.g. "www.example.com:80"
+	AuthorityForm
+	// AsteriskForm is "*", the server as a whole in an OPTIONS request
+	AsteriskForm
+)
+
+// Target is the parsed request-target of a request
+type Target struct {
+	Form TargetForm
+	// Scheme is only set for the absolute-form, lower-cased
+	Scheme string
+	// Authority is the host and optional port of the absolute and
+	// authority forms
+	Authority string
+	// Path is percent-decoded, with its "." and ".." segments removed, except
+	// for "%" and "/" which stay encoded as "%25" and "%2F": decoding a slash
+	// would split its segment in two, and keeping "%" encoded tells "%2F"
+	// apart from "%252F". It is empty for the authority and asterisk forms.
+	Path string
+	// RawPath is the path as it was sent
+	RawPath string
+	// RawQuery is the query without its "?", still percent-encoded
+	RawQuery string
+	// Fragment is not part of a valid request-target, but some clients send
+	// it anyway, so it is split off rather than left in the query or path
+	Fragment string
+}
+
+// parseTarget parses the request-target of a request with the given method,
+// the offsets of its errors are relative to the start of the target. Only
+// lenient parsing accepts non-ASCII bytes.
+func parseTarget(method, target string, lenient bool) (Target, *ParseError) {
+	if target == "" {
+		return Target{}, parseErrorf(0, ErrInvalidTarget, "empty request-target")
+	}
+	for i := 0; i < len(target); i++ {
+		if target[i] <= ' ' || target[i] == 0x7f {
+			return Target{}, parseErrorf(i, ErrInvalidTarget, "control character or whitespace in %q", target)
+		}
+		if target[i] >= 0x80 && !lenient {
+			return Target{}, parseErrorf(i, ErrInvalidTarget, "non-ASCII byte in %q", target)
+		}
+	}
+	if target == "*" {
+		if method != "OPTIONS" {
+			return Target{}, parseErrorf(0, ErrInvalidTarget, "%q is only allowed for OPTIONS", target)
+		}
+		return Target{Form: AsteriskForm}, nil
+	}
+	if method == "CONNECT" {
+		if i := strings.IndexAny(target, "/?#@"); i != -1 {
+			return Target{}, parseErrorf(i, ErrInvalidTarget, "%q is not an authority", target)
+		}
+		// the host may be an IPv6 address in brackets, e.g. "[::1]:443"
+		if host, port, err := net.SplitHostPort(target); err != nil || host == "" || !isDigits(port) {
+			return Target{}, parseErrorf(0, ErrInvalidTarget, "%q is not a host and port", target)
+		}
+		return Target{Form: AuthorityForm, Authority: target}, nil
+	}
+
+	t := Target{Form: OriginForm}
+	rest := target
+	offset := 0
+	if !strings.HasPrefix(target, "/") {
+		scheme, afterScheme, ok := strings.Cut(target, "://")
+		if !ok || !isScheme(scheme) {
+			return Target{}, parseErrorf(0, ErrInvalidTarget, "%q is neither a path nor an absolute URI", target)
+		}
+		t.Form = AbsoluteForm
+		t.Scheme = strings.ToLower(scheme)
+		end := strings.IndexAny(afterScheme, "/?#")
+		if end == -1 {
+			end = len(afterScheme)
+		}
+		t.Authority = afterScheme[:end]
+		if t.Authority == "" {
+			return Target{}, parseErrorf(len(scheme)+3, ErrInvalidTarget, "missing host in %q", target)
+		}
+		rest = afterScheme[end:]
+		offset = len(target) - len(rest)
+	}
+
+	rest, t.Fragment, _ = strings.Cut(rest, "#")
+	t.RawPath, t.RawQuery, _ = strings.Cut(rest, "?")
+	if t.RawPath == "" {
+		// an absolute URI without a path, e.g. "http://example.org?q"
+		t.RawPath = "/"
+	}
+	path, err := removeDotSegments(t.RawPath)
+	if err != nil {
+		return Target{}, parseErrorf(offset, ErrInvalidTarget, "%v", err)
+	}
+	t.Path = path
+	return t, nil
+}
+
+// removeDotSegments percent-decodes an absolute path and resolves its "." and
+// ".." segments, as in RFC 3986 section 5.2.4. ".." never goes above the root.
+// The path is split at its raw slashes before decoding, so that "%2F" can't
+// add a segment nor "..%2F" climb out of one, and "%" and "/" are encoded
+// again afterwards. Encoded dots still make dot segments, e.g. "%2e%2e".
+func removeDotSegments(rawPath string) (string, error) {
+	segments := strings.Split(rawPath, "/")[1:]
+	out := make([]string, 0, len(segments))
+	for i, segment := range segments {
+		segment, err := url.PathUnescape(segment)
+		if err != nil {
+			return "", err
+		}
+		last := i == len(segments)-1
+		switch segment {
+		case ".":
+			if last {
+				// "/a/." is the directory "/a/"
+				out = append(out, "")
+			}
+		case "..":
+			if len(out) > 0 {
+				out = out[:len(out)-1]
+			}
+			if last {
+				out = append(out, "")
+			}
+		default:
+			out = append(out, pathEscaper.Replace(segment))
+		}
+	}
+	return "/" + strings.Join(out, "/"), nil
+}
+
+// pathEscaper encodes the bytes of a decoded segment that Path keeps encoded
+var pathEscaper = strings.NewReplacer("%", "%25", "/", "%2F")
+
+// isScheme reports whether s is a valid URI scheme, a letter followed by
+// letters, digits, "+", "-" or "."
+func isScheme(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, c := range s {
+		isLetter := (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z')
+		isNumber := c >= '0' && c <= '9'
+		if !isLetter && (i == 0 || (!isNumber && !strings.ContainsRune("+-.", c))) {
+			return false
+		}
+	}
+	return true
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// QueryValues returns every value of the named query parameter, in the order
+// they appear in the request-target
+func (r *Request) QueryValues(name string) []string {
+	if r.query == nil {
+		// malformed pairs are skipped, the well-formed ones are still usable
+		r.query, _ = url.ParseQuery(r.RequestLine.Target.RawQuery)
+	}
+	return r.query[name]
+}
+
+// QueryValue returns the first value of the named query parameter, or an
+// empty string if there is none
+func (r *Request) QueryValue(name string) string {
+	values := r.QueryValues(name)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
@@ -0,0 +1,84 @@
+package request
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTargetParse(t *testing.T) {
+	tests := []struct {
+		method string
+		target string
+		want   Target
+	}{
+		{"GET", "/", Target{Form: OriginForm, Path: "/", RawPath: "/"}},
+		{"GET", "/where?q=now&q=later", Target{Form: OriginForm, Path: "/where", RawPath: "/where", RawQuery: "q=now&q=later"}},
+		{"GET", "/a%20b/%E2%9C%93", Target{Form: OriginForm, Path: "/a b/✓", RawPath: "/a%20b/%E2%9C%93"}},
+		{"GET", "/a/./b/../c", Target{Form: OriginForm, Path: "/a/c", RawPath: "/a/./b/../c"}},
+		{"GET", "/a/%2e%2e/%2E%2E/../etc", Target{Form: OriginForm, Path: "/etc", RawPath: "/a/%2e%2e/%2E%2E/../etc"}},
+		{"GET", "/a/b/..", Target{Form: OriginForm, Path: "/a/", RawPath: "/a/b/.."}},
+		{"GET", "/public/..%2Fadmin", Target{Form: OriginForm, Path: "/public/..%2Fadmin", RawPath: "/public/..%2Fadmin"}},
+		{"GET", "/files/a%2fb/../c", Target{Form: OriginForm, Path: "/files/c", RawPath: "/files/a%2fb/../c"}},
+		{"GET", "/files/a%2Fb", Target{Form: OriginForm, Path: "/files/a%2Fb", RawPath: "/files/a%2Fb"}},
+		{"GET", "/files/a%252Fb", Target{Form: OriginForm, Path: "/files/a%252Fb", RawPath: "/files/a%252Fb"}},
+		{"GET", "/100%25/%41", Target{Form: OriginForm, Path: "/100%25/A", RawPath: "/100%25/%41"}},
+		{"GET", "/page#top", Target{Form: OriginForm, Path: "/page", RawPath: "/page", Fragment: "top"}},
+		{"GET", "HTTP://www.example.org/pub/WWW/?x=1", Target{
+			Form: AbsoluteForm, Scheme: "http", Authority: "www.example.org",
+			Path: "/pub/WWW/", RawPath: "/pub/WWW/", RawQuery: "x=1",
+		}},
+		{"GET", "http://example.org:8080", Target{Form: AbsoluteForm, Scheme: "http", Authority: "example.org:8080", Path: "/", RawPath: "/"}},
+		{"CONNECT", "www.example.com:443", Target{Form: AuthorityForm, Authority: "www.example.com:443"}},
+		{"CONNECT", "[::1]:443", Target{Form: AuthorityForm, Authority: "[::1]:443"}},
+		{"CONNECT", "[2001:db8::7]:8080", Target{Form: AuthorityForm, Authority: "[2001:db8::7]:8080"}},
+		{"OPTIONS", "*", Target{Form: AsteriskForm}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			r, err := RequestFromReader(strings.NewReader(tt.method + " " + tt.target + " HTTP/1.1\r\nHost: localhost:42069\r\n\r\n"))
+			require.NoError(t, err)
+			assert.Equal(t, tt.target, r.RequestLine.RequestTarget)
+			assert.Equal(t, tt.want, r.RequestLine.Target)
+		})
+	}
+}
+
+func TestInvalidTargets(t *testing.T) {
+	tests := []struct {
+		method string
+		target string
+		offset int
+	}{
+		{"GET", "*", 4},
+		{"GET", "where", 4},
+		{"GET", "http:///path", 11},
+		{"GET", "/bad%zzescape", 4},
+		{"CONNECT", "www.example.com", 8},
+		{"CONNECT", "www.example.com:443/path", 27},
+		{"CONNECT", "::1:443", 8},
+		{"CONNECT", "[::1]", 8},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			_, err := RequestFromReader(strings.NewReader(tt.method + " " + tt.target + " HTTP/1.1\r\nHost: localhost:42069\r\n\r\n"))
+			require.ErrorIs(t, err, ErrInvalidTarget)
+			parseErr := &ParseError{}
+			require.ErrorAs(t, err, &parseErr)
+			assert.Equal(t, tt.offset, parseErr.Offset)
+		})
+	}
+}
+
+func TestQueryValues(t *testing.T) {
+	r, err := RequestFromReader(strings.NewReader("GET /search?tag=go&q=a+b%21&tag=http&empty= HTTP/1.1\r\nHost: localhost:42069\r\n\r\n"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"go", "http"}, r.QueryValues("tag"))
+	assert.Equal(t, "go", r.QueryValue("tag"))
+	assert.Equal(t, "a b!", r.QueryValue("q"))
+	assert.Equal(t, []string{""}, r.QueryValues("empty"))
+	assert.Nil(t, r.QueryValues("missing"))
+	assert.Equal(t, "", r.QueryValue("missing"))
+}
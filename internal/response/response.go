@@ -9,70 +9,452 @@ import (
 	"httpfromtcp/internal/headers"
 )
 
-type StatusCode int
-
 const (
-	StatusOK                  StatusCode = 200
-	StatusBadRequest          StatusCode = 400
-	StatusInternalServerError StatusCode = 500
+	writerStateStatusLine int = iota
+	writerStateHeaders
+	writerStateBody
+	writerStateTrailers
+	writerStateDone
 )
 
+// writerStateNames describes what the writer expects next in each state
+var writerStateNames = map[int]string{
+	writerStateStatusLine: "status line",
+	writerStateHeaders:    "headers",
+	writerStateBody:       "body",
+	writerStateTrailers:   "trailers",
+	writerStateDone:       "nothing (the response is complete)",
+}
+
+// WriteOrderError is returned when a part of the response is written out of
+// order, e.g. the body before the status line or the headers twice.
+type WriteOrderError struct {
+	Attempted string // the part of the response that was being written
+	Expected  string // the part the writer expected next
+}
+
+func (e *WriteOrderError) Error() string {
+	return fmt.Sprintf("error: cannot write the %s, expected %s", e.Attempted, e.Expected)
+}
+
 type Writer struct {
-	writer io.Writer
+	writer    io.Writer
+	state     int
+	keepAlive bool // whether the connection can serve another request after this response
+	// the client waits for a 100 Continue before sending the body
+	expectContinue bool
+	continueSent   bool
+	// the client speaks HTTP/1.0, which has no chunked encoding
+	http10 bool
+	// a chunked body is written as is, delimited by closing the connection
+	unframed bool
+	// the body is sent with the chunked encoding, so it isn't complete until
+	// the last chunk and the announced trailers are written
+	chunked bool
+	// lower-cased field names announced in the Trailer header, the only ones
+	// WriteTrailers accepts
+	announcedTrailers map[string]bool
+	// exact spellings of field names, keyed by their lower-case form
+	spellings map[string]string
+
+	statusCode   StatusCode
+	headers      *headers.Headers
+	bytesWritten int
+
+	headersHooks []func(statusCode StatusCode, h *headers.Headers)
+	bodyHooks    []func(p []byte)
+
+	logger *log.Logger
 }
 
 func NewWriter(writer io.Writer) *Writer {
 	return &Writer{
-		writer: writer,
+		writer:    writer,
+		keepAlive: true,
+		logger:    log.Default(),
+	}
+}
+
+// SetLogger is used by the server to have the errors writing the response
+// logged to its own logger rather than the standard one
+func (w *Writer) SetLogger(logger *log.Logger) {
+	w.logger = logger
+}
+
+// Logger returns the logger the writer reports its errors to, which
+// middleware can log the request to as well
+func (w *Writer) Logger() *log.Logger {
+	return w.logger
+}
+
+// SetKeepAlive is used by the server to decide, before the handler runs, whether
+// the connection will be closed after this response. When false, a
+// "Connection: close" header is added to the response headers.
+func (w *Writer) SetKeepAlive(keepAlive bool) {
+	w.keepAlive = keepAlive
+}
+
+// KeepAlive reports whether the connection can be reused once the response is
+// written. It is false if the server disabled it or the handler sent
+// "Connection: close" itself.
+func (w *Writer) KeepAlive() bool {
+	return w.keepAlive
+}
+
+// SetRequestVersion is used by the server to tell the writer the HTTP version
+// of the request, e.g. "1.0". HTTP/1.0 clients get a "Connection: keep-alive"
+// header when the connection is kept open, and chunked bodies are sent
+// without the chunked encoding, the end of the body being marked by closing
+// the connection. Their trailers are dropped.
+func (w *Writer) SetRequestVersion(httpVersion string) {
+	w.http10 = httpVersion == "1.0"
+}
+
+// ForceSpelling makes the writer send the given field names exactly as they are
+// spelled here instead of in their canonical form, e.g. "X-Content-SHA256"
+// rather than "X-Content-Sha256", for clients that match names
+// case-sensitively. It applies to headers and trailers written afterwards.
+func (w *Writer) ForceSpelling(names ...string) {
+	if w.spellings == nil {
+		w.spellings = map[string]string{}
+	}
+	for _, name := range names {
+		w.spellings[strings.ToLower(name)] = name
 	}
 }
 
+// ExpectContinue is used by the server when the client sent "Expect:
+// 100-continue" and waits for the interim response before sending its body. If
+// the final response is started without WriteContinue having been called, the
+// connection is closed after it, since the body may or may not follow.
+func (w *Writer) ExpectContinue() {
+	w.expectContinue = true
+}
+
+// WriteContinue writes the "100 Continue" interim response, if the client
+// expects one and it wasn't written yet. It must come before the headers.
+func (w *Writer) WriteContinue() error {
+	if !w.expectContinue || w.continueSent {
+		return nil
+	}
+	if w.state != writerStateStatusLine && w.state != writerStateHeaders {
+		err := &WriteOrderError{Attempted: "100 Continue", Expected: writerStateNames[w.state]}
+		w.logger.Println(err)
+		return err
+	}
+	w.continueSent = true
+	_, err := w.writer.Write([]byte("HTTP/1.1 100 Continue\r\n\r\n"))
+	return err
+}
+
+// Written reports whether the status line and headers reached the underlying
+// writer, i.e. whether it is too late to send a different response. A status
+// line alone is held back until WriteHeaders, so it doesn't count.
+func (w *Writer) Written() bool {
+	return w.state >= writerStateBody
+}
+
+// StatusCode returns the status code of the response, or 0 if none was
+// written yet
+func (w *Writer) StatusCode() StatusCode {
+	return w.statusCode
+}
+
+// Headers returns the headers as they were written, or nil before WriteHeaders
+func (w *Writer) Headers() *headers.Headers {
+	return w.headers
+}
+
+// BytesWritten returns the number of body bytes written so far, not counting
+// the chunked encoding framing
+func (w *Writer) BytesWritten() int {
+	return w.bytesWritten
+}
+
+// OnWriteHeaders registers a hook called with the status code and headers
+// right before they are written to the connection. The hook can still modify
+// the headers. Hooks are called in the order they were registered.
+func (w *Writer) OnWriteHeaders(hook func(statusCode StatusCode, h *headers.Headers)) {
+	w.headersHooks = append(w.headersHooks, hook)
+}
+
+// OnWriteBody registers a hook called with every piece of the body right
+// before it is written to the connection
+func (w *Writer) OnWriteBody(hook func(p []byte)) {
+	w.bodyHooks = append(w.bodyHooks, hook)
+}
+
+// checkState returns a WriteOrderError unless the writer is in state
+func (w *Writer) checkState(state int, attempted string) error {
+	if w.state != state {
+		err := &WriteOrderError{Attempted: attempted, Expected: writerStateNames[w.state]}
+		w.logger.Println(err)
+		return err
+	}
+	return nil
+}
+
+// WriteStatusLine sets the status code of the response, which must be a final
+// one: 1xx codes are rejected
 func (w *Writer) WriteStatusLine(statusCode StatusCode) error {
-	switch statusCode {
-	case StatusOK:
-		w.writer.Write([]byte("HTTP/1.1 200 OK \r\n"))
-	case StatusBadRequest:
-		w.writer.Write([]byte("HTTP/1.1 400 Bad Request \r\n"))
-	case StatusInternalServerError:
-		w.writer.Write([]byte("HTTP/1.1 500 Internal Server Error \r\n"))
-	default:
-		err := fmt.Errorf("error: unrecognized status code: %v", statusCode)
-		log.Println(err)
+	if err := w.checkState(writerStateStatusLine, "status line"); err != nil {
 		return err
 	}
+	if !statusCode.Valid() {
+		err := fmt.Errorf("error: invalid status code: %v", statusCode)
+		w.logger.Println(err)
+		return err
+	}
+	if statusCode < 200 {
+		// an interim response isn't the response, the client would keep
+		// waiting for the final one, see WriteContinue
+		err := fmt.Errorf("error: %v is not a final status code", statusCode)
+		w.logger.Println(err)
+		return err
+	}
+	// the status line is written together with the headers, so that hooks get
+	// to see both before anything reaches the connection
+	w.statusCode = statusCode
+	w.state = writerStateHeaders
 	return nil
 }
 
-func GetDefaultHeaders(contentLen int) headers.Headers {
+// DiscardStatusLine drops a status line given to WriteStatusLine but not
+// written yet, so that a different response can still be started, e.g. an
+// error response after the handler failed. It does nothing once the headers
+// are written.
+func (w *Writer) DiscardStatusLine() {
+	if w.state == writerStateHeaders {
+		w.statusCode = 0
+		w.state = writerStateStatusLine
+	}
+}
+
+func GetDefaultHeaders(contentLen int) *headers.Headers {
 	headers := headers.NewHeaders()
-	headers["content-length"] = fmt.Sprintf("%d", contentLen)
-	headers["connection"] = "close"
-	headers["content-type"] = "text/plain"
+	headers.Set("Content-Length", fmt.Sprintf("%d", contentLen))
+	headers.Set("Content-Type", "text/plain")
 
 	return headers
 }
 
-func (w *Writer) WriteHeaders(h headers.Headers) error {
-	data := []byte{}
-	for key, value := range h {
-		data = fmt.Appendf(data, "%s: %s\r\n", strings.Title(key), value)
+func (w *Writer) WriteHeaders(h *headers.Headers) error {
+	if err := w.checkState(writerStateHeaders, "headers"); err != nil {
+		return err
 	}
-	data = fmt.Appendf(data, "\r\n")
-	_, err := w.writer.Write(data)
+	if w.expectContinue && !w.continueSent {
+		w.keepAlive = false
+	}
+	if w.http10 && h.HasToken("Transfer-Encoding", "chunked") {
+		h.Del("Transfer-Encoding")
+		w.unframed = true
+		w.keepAlive = false
+	}
+	if !w.keepAlive {
+		h.Set("Connection", "close")
+	} else if h.HasToken("Connection", "close") {
+		w.keepAlive = false
+	} else if w.http10 {
+		// HTTP/1.0 connections are closed unless told otherwise
+		h.Set("Connection", "keep-alive")
+	}
+	w.announcedTrailers = map[string]bool{}
+	for _, name := range h.List("Trailer") {
+		w.announcedTrailers[strings.ToLower(name)] = true
+	}
+	if w.unframed {
+		h.Del("Trailer")
+	}
+	for _, hook := range w.headersHooks {
+		hook(w.statusCode, h)
+	}
+	// a CR or LF in a value would let it end its line and inject fields, or
+	// even a whole response, so nothing is written unless every field is valid
+	if err := h.Validate(); err != nil {
+		err = fmt.Errorf("error: invalid header: %w", err)
+		w.logger.Println(err)
+		return err
+	}
+	w.headers = h
+	w.chunked = !w.unframed && h.HasToken("Transfer-Encoding", "chunked")
+	w.state = writerStateBody
+
+	// the reason phrase is optional, but the space before it is not
+	statusLine := fmt.Sprintf("HTTP/1.1 %03d %s\r\n", int(w.statusCode), StatusText(w.statusCode))
+	if _, err := w.writer.Write([]byte(statusLine)); err != nil {
+		w.logger.Printf("error writing status line: %v", err)
+		return err
+	}
+	err := w.writeFields(h)
 	if err != nil {
-		log.Printf("error writing headers: %v", err)
+		w.logger.Printf("error writing headers: %v", err)
 		return err
 	}
 
 	return nil
 }
 
+// writeFields writes a field section (headers or trailers) and the empty line
+// that terminates it, in the order the fields were added. Names are written
+// in their canonical form unless their spelling was forced.
+func (w *Writer) writeFields(h *headers.Headers) error {
+	data := []byte{}
+	for name, value := range h.All() {
+		if spelling, ok := w.spellings[strings.ToLower(name)]; ok {
+			name = spelling
+		} else {
+			name = headers.CanonicalName(name)
+		}
+		data = fmt.Appendf(data, "%s: %s\r\n", name, value)
+	}
+	data = fmt.Appendf(data, "\r\n")
+	_, err := w.writer.Write(data)
+	return err
+}
+
 func (w *Writer) WriteBody(p []byte) (int, error) {
+	if err := w.checkState(writerStateBody, "body"); err != nil {
+		return 0, err
+	}
+	for _, hook := range w.bodyHooks {
+		hook(p)
+	}
 	n, err := w.writer.Write(p)
+	w.bytesWritten += n
 	if err != nil {
-		log.Printf("error writing body: %v", err)
+		w.logger.Printf("error writing body: %v", err)
 		return 0, err
 	}
 	return n, nil
 }
 
+// WriteChunkedBody writes p as a single chunk of a response sent with
+// "Transfer-Encoding: chunked". Writing an empty slice is a no-op, since a zero
+// sized chunk would end the body.
+func (w *Writer) WriteChunkedBody(p []byte) (int, error) {
+	if err := w.checkState(writerStateBody, "body"); err != nil {
+		return 0, err
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	for _, hook := range w.bodyHooks {
+		hook(p)
+	}
+	data := p
+	if !w.unframed {
+		data = fmt.Appendf(nil, "%x\r\n", len(p))
+		data = append(data, p...)
+		data = append(data, "\r\n"...)
+	}
+	if _, err := w.writer.Write(data); err != nil {
+		w.logger.Printf("error writing chunk: %v", err)
+		return 0, err
+	}
+	w.bytesWritten += len(p)
+	return len(p), nil
+}
+
+// WriteChunkedBodyDone writes the last (zero sized) chunk. If no trailers were
+// announced in the Trailer header the message is terminated as well, otherwise
+// it is up to WriteTrailers to terminate it.
+func (w *Writer) WriteChunkedBodyDone() (int, error) {
+	if err := w.checkState(writerStateBody, "last chunk"); err != nil {
+		return 0, err
+	}
+	data := []byte("0\r\n")
+	if len(w.announcedTrailers) == 0 {
+		data = append(data, "\r\n"...)
+		w.state = writerStateDone
+	} else {
+		w.state = writerStateTrailers
+	}
+	if w.unframed {
+		return 0, nil
+	}
+	n, err := w.writer.Write(data)
+	if err != nil {
+		w.logger.Printf("error writing last chunk: %v", err)
+		return 0, err
+	}
+	return n, nil
+}
+
+// WriteTrailers writes the trailer section after WriteChunkedBodyDone. Every
+// field in h must have been announced in the Trailer header of the response.
+func (w *Writer) WriteTrailers(h *headers.Headers) error {
+	if err := w.checkState(writerStateTrailers, "trailers"); err != nil {
+		return err
+	}
+	for key := range h.All() {
+		if !w.announcedTrailers[strings.ToLower(key)] {
+			return fmt.Errorf("error: trailer %q was not announced in the Trailer header", key)
+		}
+	}
+	if err := h.Validate(); err != nil {
+		err = fmt.Errorf("error: invalid trailer: %w", err)
+		w.logger.Println(err)
+		return err
+	}
+	w.state = writerStateDone
+	if w.unframed {
+		return nil
+	}
+	if err := w.writeFields(h); err != nil {
+		w.logger.Printf("error writing trailers: %v", err)
+		return err
+	}
+	return nil
+}
+
+// Complete reports whether the response is a whole message: the headers were
+// written and, for a chunked body, the last chunk and the announced trailers
+// as well. A body sent with a Content-Length is not checked.
+func (w *Writer) Complete() bool {
+	switch w.state {
+	case writerStateDone:
+		return true
+	case writerStateBody:
+		return !w.chunked
+	}
+	return false
+}
+
+// Finish completes a response whose handler left its chunked body open, by
+// writing the last chunk and, if trailers were announced, an empty trailer
+// section. It does nothing if the response is already complete.
+func (w *Writer) Finish() error {
+	if w.state == writerStateBody && w.chunked {
+		if _, err := w.WriteChunkedBodyDone(); err != nil {
+			return err
+		}
+	}
+	if w.state == writerStateTrailers {
+		return w.WriteTrailers(headers.NewHeaders())
+	}
+	if !w.Complete() {
+		err := &WriteOrderError{Attempted: "end of the response", Expected: writerStateNames[w.state]}
+		w.logger.Println(err)
+		return err
+	}
+	return nil
+}
+
+// ChunkedWriter returns an io.WriteCloser that streams the body as chunks.
+// Close writes the last chunk, but not the trailers.
+func (w *Writer) ChunkedWriter() io.WriteCloser {
+	return &chunkedWriter{w: w}
+}
+
+type chunkedWriter struct {
+	w *Writer
+}
+
+func (cw *chunkedWriter) Write(p []byte) (int, error) {
+	return cw.w.WriteChunkedBody(p)
+}
+
+func (cw *chunkedWriter) Close() error {
+	_, err := cw.w.WriteChunkedBodyDone()
+	return err
+}
@@ -0,0 +1,403 @@
+package response
+
+import (
+	"bytes"
+	"log"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"httpfromtcp/internal/headers"
+)
+
+func TestChunkedBody(t *testing.T) {
+	// Test: chunk framing without trailers
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	h := headers.NewHeaders()
+	h.Set("Transfer-Encoding", "chunked")
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	require.NoError(t, w.WriteHeaders(h))
+	buf.Reset()
+	n, err := w.WriteChunkedBody([]byte("hello world!"))
+	require.NoError(t, err)
+	assert.Equal(t, 12, n)
+	n, err = w.WriteChunkedBody([]byte{})
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+	_, err = w.WriteChunkedBodyDone()
+	require.NoError(t, err)
+	assert.Equal(t, "c\r\nhello world!\r\n0\r\n\r\n", buf.String())
+
+	// Test: announced trailers terminate the message
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	h = headers.NewHeaders()
+	h.Set("Transfer-Encoding", "chunked")
+	h.Set("Trailer", "X-Checksum")
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	require.NoError(t, w.WriteHeaders(h))
+	buf.Reset()
+	body := w.ChunkedWriter()
+	_, err = body.Write([]byte("data"))
+	require.NoError(t, err)
+	require.NoError(t, body.Close())
+	trailers := headers.NewHeaders()
+	trailers.Set("X-Checksum", "abc123")
+	require.NoError(t, w.WriteTrailers(trailers))
+	assert.Equal(t, "4\r\ndata\r\n0\r\nX-Checksum: abc123\r\n\r\n", buf.String())
+
+	// Test: trailer that was not announced
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	h = headers.NewHeaders()
+	h.Set("Transfer-Encoding", "chunked")
+	h.Set("Trailer", "X-Checksum")
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	require.NoError(t, w.WriteHeaders(h))
+	_, err = w.WriteChunkedBodyDone()
+	require.NoError(t, err)
+	trailers = headers.NewHeaders()
+	trailers.Set("X-Length", "4")
+	require.Error(t, w.WriteTrailers(trailers))
+}
+
+func TestWriterOrder(t *testing.T) {
+	// Test: body before the status line, reported to the writer's logger
+	buf := &bytes.Buffer{}
+	logs := &bytes.Buffer{}
+	w := NewWriter(buf)
+	w.SetLogger(log.New(logs, "", 0))
+	assert.False(t, w.Written())
+	_, err := w.WriteBody([]byte("hello"))
+	var orderErr *WriteOrderError
+	require.ErrorAs(t, err, &orderErr)
+	assert.Equal(t, "body", orderErr.Attempted)
+	assert.Equal(t, "status line", orderErr.Expected)
+	assert.False(t, w.Written())
+	assert.Equal(t, "", buf.String())
+	assert.Equal(t, orderErr.Error()+"\n", logs.String())
+
+	// Test: headers before the status line
+	err = w.WriteHeaders(GetDefaultHeaders(0))
+	require.ErrorAs(t, err, &orderErr)
+
+	// Test: status line, headers and body in order
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	assert.False(t, w.Written())
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(5)))
+	assert.True(t, w.Written())
+	_, err = w.WriteBody([]byte("hello"))
+	require.NoError(t, err)
+
+	// Test: status line and headers written twice
+	err = w.WriteStatusLine(StatusOK)
+	require.ErrorAs(t, err, &orderErr)
+	assert.Equal(t, "status line", orderErr.Attempted)
+	err = w.WriteHeaders(GetDefaultHeaders(0))
+	require.ErrorAs(t, err, &orderErr)
+
+	// Test: a pending status line can be discarded, a written one can't
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	w.DiscardStatusLine()
+	assert.Equal(t, StatusCode(0), w.StatusCode())
+	require.NoError(t, w.WriteStatusLine(StatusInternalServerError))
+	require.NoError(t, w.WriteHeaders(headers.NewHeaders()))
+	w.DiscardStatusLine()
+	assert.Equal(t, StatusInternalServerError, w.StatusCode())
+	assert.Equal(t, "HTTP/1.1 500 Internal Server Error\r\n\r\n", buf.String())
+
+	// Test: nothing can be written after a chunked body is done
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	require.NoError(t, w.WriteHeaders(headers.NewHeaders()))
+	_, err = w.WriteChunkedBodyDone()
+	require.NoError(t, err)
+	_, err = w.WriteChunkedBody([]byte("late"))
+	require.ErrorAs(t, err, &orderErr)
+	err = w.WriteTrailers(headers.NewHeaders())
+	require.ErrorAs(t, err, &orderErr)
+}
+
+func TestWriteStatusLine(t *testing.T) {
+	// Test: registered status codes
+	for code, line := range map[StatusCode]string{
+		StatusOK:                  "HTTP/1.1 200 OK\r\n",
+		StatusNoContent:           "HTTP/1.1 204 No Content\r\n",
+		StatusNotFound:            "HTTP/1.1 404 Not Found\r\n",
+		StatusTooManyRequests:     "HTTP/1.1 429 Too Many Requests\r\n",
+		StatusServiceUnavailable:  "HTTP/1.1 503 Service Unavailable\r\n",
+		StatusInternalServerError: "HTTP/1.1 500 Internal Server Error\r\n",
+	} {
+		buf := &bytes.Buffer{}
+		w := NewWriter(buf)
+		require.NoError(t, w.WriteStatusLine(code))
+		require.NoError(t, w.WriteHeaders(headers.NewHeaders()))
+		assert.Equal(t, line+"\r\n", buf.String())
+	}
+
+	// Test: unknown status code without a reason phrase
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	require.NoError(t, w.WriteStatusLine(StatusCode(299)))
+	require.NoError(t, w.WriteHeaders(headers.NewHeaders()))
+	assert.Equal(t, "HTTP/1.1 299 \r\n\r\n", buf.String())
+
+	// Test: status code that is not three digits
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	require.Error(t, w.WriteStatusLine(StatusCode(42)))
+	require.Error(t, w.WriteStatusLine(StatusCode(1000)))
+	assert.False(t, w.Written())
+	assert.Equal(t, "", buf.String())
+
+	// Test: interim status codes aren't a response
+	require.Error(t, w.WriteStatusLine(StatusContinue))
+	require.Error(t, w.WriteStatusLine(StatusEarlyHints))
+	assert.False(t, w.Written())
+	assert.Equal(t, "", buf.String())
+
+	// Test: custom status code
+	require.NoError(t, RegisterStatus(StatusCode(599), "Network Connect Timeout"))
+	assert.Equal(t, "Network Connect Timeout", StatusText(599))
+	require.NoError(t, w.WriteStatusLine(StatusCode(599)))
+	require.NoError(t, w.WriteHeaders(headers.NewHeaders()))
+	assert.Equal(t, "HTTP/1.1 599 Network Connect Timeout\r\n\r\n", buf.String())
+
+	// Test: invalid custom status codes and phrases
+	require.Error(t, RegisterStatus(StatusCode(99), "Too Short"))
+	require.Error(t, RegisterStatus(StatusCode(598), "Bad\r\nPhrase"))
+}
+
+func TestWriterHooks(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	var observedStatus StatusCode
+	body := []byte{}
+	w.OnWriteHeaders(func(statusCode StatusCode, h *headers.Headers) {
+		observedStatus = statusCode
+		// nothing has reached the connection yet
+		assert.Equal(t, "", buf.String())
+		h.Set("X-Request-Id", "42")
+	})
+	w.OnWriteBody(func(p []byte) {
+		body = append(body, p...)
+	})
+
+	require.NoError(t, w.WriteStatusLine(StatusCreated))
+	assert.Equal(t, StatusCreated, w.StatusCode())
+	assert.Nil(t, w.Headers())
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(11)))
+	assert.Equal(t, StatusCreated, observedStatus)
+	assert.Equal(t, "42", w.Headers().Get("X-Request-Id"))
+	assert.Contains(t, buf.String(), "X-Request-Id: 42\r\n")
+
+	_, err := w.WriteBody([]byte("hello "))
+	require.NoError(t, err)
+	_, err = w.WriteBody([]byte("world"))
+	require.NoError(t, err)
+	assert.Equal(t, "hello world", string(body))
+	assert.Equal(t, 11, w.BytesWritten())
+}
+
+func TestWriteContinue(t *testing.T) {
+	// Test: not written unless the client expects it
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	require.NoError(t, w.WriteContinue())
+	assert.Equal(t, "", buf.String())
+
+	// Test: written once, before the final response
+	w.ExpectContinue()
+	require.NoError(t, w.WriteContinue())
+	require.NoError(t, w.WriteContinue())
+	assert.False(t, w.Written())
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	require.NoError(t, w.WriteHeaders(headers.NewHeaders()))
+	assert.Equal(t, "HTTP/1.1 100 Continue\r\n\r\nHTTP/1.1 200 OK\r\n\r\n", buf.String())
+	assert.True(t, w.KeepAlive())
+
+	// Test: a final response without it closes the connection
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	w.ExpectContinue()
+	require.NoError(t, w.WriteStatusLine(StatusContentTooLarge))
+	require.NoError(t, w.WriteHeaders(headers.NewHeaders()))
+	assert.Equal(t, "HTTP/1.1 413 Content Too Large\r\nConnection: close\r\n\r\n", buf.String())
+	assert.False(t, w.KeepAlive())
+
+	// Test: too late once the headers are written
+	var orderErr *WriteOrderError
+	require.ErrorAs(t, w.WriteContinue(), &orderErr)
+}
+
+func TestHTTP10Response(t *testing.T) {
+	// Test: a kept-alive connection is announced
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	w.SetRequestVersion("1.0")
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	require.NoError(t, w.WriteHeaders(headers.NewHeaders()))
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nConnection: keep-alive\r\n\r\n", buf.String())
+	assert.True(t, w.KeepAlive())
+
+	// Test: a chunked body is sent as is and ends with the connection
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	w.SetRequestVersion("1.0")
+	h := headers.NewHeaders()
+	h.Set("Transfer-Encoding", "chunked")
+	h.Set("Trailer", "X-Checksum")
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	require.NoError(t, w.WriteHeaders(h))
+	_, err := w.WriteChunkedBody([]byte("hello "))
+	require.NoError(t, err)
+	_, err = w.WriteChunkedBody([]byte("world!"))
+	require.NoError(t, err)
+	_, err = w.WriteChunkedBodyDone()
+	require.NoError(t, err)
+	trailers := headers.NewHeaders()
+	trailers.Set("X-Checksum", "abc123")
+	require.NoError(t, w.WriteTrailers(trailers))
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nConnection: close\r\n\r\nhello world!", buf.String())
+	assert.False(t, w.KeepAlive())
+}
+
+func TestWriteHeadersOrder(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	h := headers.NewHeaders()
+	h.Add("Content-Type", "text/html")
+	h.Add("Set-Cookie", "session=abc; HttpOnly")
+	h.Add("X-Request-ID", "42")
+	h.Add("Set-Cookie", "theme=dark, light")
+	h.Add("Content-Length", "0")
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	require.NoError(t, w.WriteHeaders(h))
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"Content-Type: text/html\r\n"+
+		"Set-Cookie: session=abc; HttpOnly\r\n"+
+		"X-Request-Id: 42\r\n"+
+		"Set-Cookie: theme=dark, light\r\n"+
+		"Content-Length: 0\r\n"+
+		"\r\n", buf.String())
+}
+
+func TestHeaderInjection(t *testing.T) {
+	// Test: a CRLF in a header value writes nothing
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	h := headers.NewHeaders()
+	h.Set("Location", "/next\r\nSet-Cookie: admin=1")
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	require.Error(t, w.WriteHeaders(h))
+	assert.Empty(t, buf.String())
+
+	// Test: values added by hooks are checked too
+	w = NewWriter(buf)
+	w.OnWriteHeaders(func(statusCode StatusCode, h *headers.Headers) {
+		h.Set("X-Trace", "a\nb")
+	})
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	require.Error(t, w.WriteHeaders(headers.NewHeaders()))
+	assert.Empty(t, buf.String())
+
+	// Test: trailers
+	w = NewWriter(buf)
+	h = headers.NewHeaders()
+	h.Set("Transfer-Encoding", "chunked")
+	h.Set("Trailer", "X-Checksum")
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	require.NoError(t, w.WriteHeaders(h))
+	_, err := w.WriteChunkedBodyDone()
+	require.NoError(t, err)
+	buf.Reset()
+	trailers := headers.NewHeaders()
+	trailers.Set("X-Checksum", "abc\x00")
+	require.Error(t, w.WriteTrailers(trailers))
+	assert.Empty(t, buf.String())
+}
+
+func TestFieldNameSpelling(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	w.ForceSpelling("X-Content-SHA256", "x-legacy-token")
+	h := headers.NewHeaders()
+	h.Set("content-type", "text/plain")
+	h.Set("etag", `"v1"`)
+	h.Set("WWW-AUTHENTICATE", "Basic")
+	h.Set("x-content-sha256", "abc")
+	h.Set("X-Legacy-Token", "t")
+	h.Set("Transfer-Encoding", "chunked")
+	h.Set("Trailer", "X-Content-SHA256")
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	require.NoError(t, w.WriteHeaders(h))
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"Content-Type: text/plain\r\n"+
+		"ETag: \"v1\"\r\n"+
+		"WWW-Authenticate: Basic\r\n"+
+		"X-Content-SHA256: abc\r\n"+
+		"x-legacy-token: t\r\n"+
+		"Transfer-Encoding: chunked\r\n"+
+		"Trailer: X-Content-SHA256\r\n"+
+		"\r\n", buf.String())
+
+	// Test: forced spellings apply to trailers too
+	_, err := w.WriteChunkedBodyDone()
+	require.NoError(t, err)
+	buf.Reset()
+	trailers := headers.NewHeaders()
+	trailers.Set("x-content-sha256", "abc")
+	require.NoError(t, w.WriteTrailers(trailers))
+	assert.Equal(t, "X-Content-SHA256: abc\r\n\r\n", buf.String())
+}
+
+func TestFinish(t *testing.T) {
+	// Test: an open chunked body gets its last chunk
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	h := headers.NewHeaders()
+	h.Set("Transfer-Encoding", "chunked")
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	assert.False(t, w.Complete())
+	require.NoError(t, w.WriteHeaders(h))
+	_, err := w.WriteChunkedBody([]byte("data"))
+	require.NoError(t, err)
+	assert.False(t, w.Complete())
+	buf.Reset()
+	require.NoError(t, w.Finish())
+	assert.True(t, w.Complete())
+	assert.Equal(t, "0\r\n\r\n", buf.String())
+
+	// Test: announced trailers that were never written
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	h = headers.NewHeaders()
+	h.Set("Transfer-Encoding", "chunked")
+	h.Set("Trailer", "X-Checksum")
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	require.NoError(t, w.WriteHeaders(h))
+	buf.Reset()
+	require.NoError(t, w.Finish())
+	assert.True(t, w.Complete())
+	assert.Equal(t, "0\r\n\r\n", buf.String())
+
+	// Test: a complete response is left as it is
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(0)))
+	assert.True(t, w.Complete())
+	buf.Reset()
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "", buf.String())
+
+	// Test: a response that wasn't started can't be finished
+	w = NewWriter(buf)
+	var orderErr *WriteOrderError
+	require.ErrorAs(t, w.Finish(), &orderErr)
+}
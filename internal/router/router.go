@@ -0,0 +1,223 @@
+package router
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"httpfromtcp/internal/headers"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+	"httpfromtcp/internal/server"
+)
+
+// Router dispatches each request to the handler registered for its method and
+// path. Patterns are made of "/"-separated segments:
+//
+//	/video            exact: matches only "/video"
+//	/httpbin/         prefix: matches "/httpbin/" and every path below it
+//	/users/{id}       parameter: {id} matches a single non-empty segment
+//	/files/{path...}  wildcard: {path...} matches the rest of the path
+//
+// Matched parameters are available to handlers via request.Request.PathValue.
+// They are taken from the decoded path, in which "%" and "/" stay encoded as
+// "%25" and "%2F".
+// Its Serve method is a server.Handler.
+type Router struct {
+	routes []*route
+
+	// NotFound is called when no route matches the path, a 404
+	// *server.HandlerError is returned if it is nil
+	NotFound server.Handler
+}
+
+type route struct {
+	method   string // empty to match any method
+	segments []segment
+	prefix   bool   // matches paths with more segments than the pattern
+	wildcard string // name the rest of the path is stored under, if any
+	handler  server.Handler
+}
+
+type segment struct {
+	literal string
+	param   string // set for {param} segments
+}
+
+func NewRouter() *Router {
+	return &Router{}
+}
+
+// Handle registers handler for requests with the given method (or any method if
+// empty) whose path matches pattern. It panics if the pattern is invalid.
+func (rt *Router) Handle(method, pattern string, handler server.Handler) {
+	r, err := parsePattern(pattern)
+	if err != nil {
+		panic(err)
+	}
+	r.method = method
+	r.handler = handler
+	rt.routes = append(rt.routes, r)
+}
+
+func (rt *Router) Get(pattern string, handler server.Handler) {
+	rt.Handle("GET", pattern, handler)
+}
+
+func (rt *Router) Post(pattern string, handler server.Handler) {
+	rt.Handle("POST", pattern, handler)
+}
+
+func (rt *Router) Put(pattern string, handler server.Handler) {
+	rt.Handle("PUT", pattern, handler)
+}
+
+func (rt *Router) Delete(pattern string, handler server.Handler) {
+	rt.Handle("DELETE", pattern, handler)
+}
+
+// Serve calls the handler of the most specific route matching the request.
+// If the path matches routes registered only for other methods, it returns a
+// 405 *server.HandlerError with an Allow header listing them, otherwise a 404.
+func (rt *Router) Serve(w *response.Writer, req *request.Request) error {
+	path := req.RequestLine.Target.Path
+	pathParts := strings.Split(strings.TrimPrefix(path, "/"), "/")
+
+	var best *route
+	var bestValues map[string]string
+	allowed := []string{}
+	for _, r := range rt.routes {
+		values, ok := r.match(pathParts)
+		if !ok {
+			continue
+		}
+		if r.method != "" && r.method != req.RequestLine.Method {
+			if !slices.Contains(allowed, r.method) {
+				allowed = append(allowed, r.method)
+			}
+			continue
+		}
+		if best == nil || r.moreSpecificThan(best) {
+			best = r
+			bestValues = values
+		}
+	}
+
+	if best != nil {
+		for name, value := range bestValues {
+			req.SetPathValue(name, value)
+		}
+		return best.handler(w, req)
+	}
+	if len(allowed) > 0 {
+		slices.Sort(allowed)
+		h := headers.NewHeaders()
+		h.Set("Allow", strings.Join(allowed, ", "))
+		return &server.HandlerError{
+			StatusCode: response.StatusMethodNotAllowed,
+			Message:    fmt.Sprintf("%s is not allowed on %s.", req.RequestLine.Method, path),
+			Headers:    h,
+		}
+	}
+	if rt.NotFound != nil {
+		return rt.NotFound(w, req)
+	}
+	return &server.HandlerError{
+		StatusCode: response.StatusNotFound,
+		Message:    fmt.Sprintf("Nothing matches %s.", path),
+	}
+}
+
+func parsePattern(pattern string) (*route, error) {
+	if !strings.HasPrefix(pattern, "/") {
+		return nil, fmt.Errorf("error: pattern %q must start with /", pattern)
+	}
+	r := &route{}
+	trimmed := strings.TrimPrefix(pattern, "/")
+	if trimmed == "" {
+		// "/" is a prefix of every path
+		r.prefix = true
+		return r, nil
+	}
+
+	parts := strings.Split(trimmed, "/")
+	last := parts[len(parts)-1]
+	if last == "" {
+		r.prefix = true
+		parts = parts[:len(parts)-1]
+	} else if strings.HasPrefix(last, "{") && strings.HasSuffix(last, "...}") {
+		r.prefix = true
+		r.wildcard = strings.TrimSuffix(strings.TrimPrefix(last, "{"), "...}")
+		if r.wildcard == "" {
+			return nil, fmt.Errorf("error: unnamed wildcard in pattern %q", pattern)
+		}
+		parts = parts[:len(parts)-1]
+	}
+
+	for _, part := range parts {
+		if strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}") {
+			name := part[1 : len(part)-1]
+			if name == "" || strings.ContainsAny(name, "{}.") {
+				return nil, fmt.Errorf("error: invalid parameter %q in pattern %q", part, pattern)
+			}
+			r.segments = append(r.segments, segment{param: name})
+		} else if strings.ContainsAny(part, "{}") {
+			return nil, fmt.Errorf("error: invalid segment %q in pattern %q", part, pattern)
+		} else {
+			r.segments = append(r.segments, segment{literal: part})
+		}
+	}
+	return r, nil
+}
+
+// match reports whether the route matches the path split in segments, and
+// returns the values of its parameters
+func (r *route) match(pathParts []string) (map[string]string, bool) {
+	if r.prefix {
+		if len(pathParts) <= len(r.segments) {
+			return nil, false
+		}
+	} else if len(pathParts) != len(r.segments) {
+		return nil, false
+	}
+
+	values := map[string]string{}
+	for i, seg := range r.segments {
+		if seg.param == "" {
+			if seg.literal != pathParts[i] {
+				return nil, false
+			}
+		} else {
+			if pathParts[i] == "" {
+				return nil, false
+			}
+			values[seg.param] = pathParts[i]
+		}
+	}
+	if r.wildcard != "" {
+		values[r.wildcard] = strings.Join(pathParts[len(r.segments):], "/")
+	}
+	return values, true
+}
+
+// moreSpecificThan orders matching routes: exact patterns win over prefixes,
+// then literal segments over parameters, then longer patterns over shorter ones
+func (r *route) moreSpecificThan(other *route) bool {
+	if r.prefix != other.prefix {
+		return !r.prefix
+	}
+	if r.literals() != other.literals() {
+		return r.literals() > other.literals()
+	}
+	return len(r.segments) > len(other.segments)
+}
+
+func (r *route) literals() int {
+	n := 0
+	for _, seg := range r.segments {
+		if seg.param == "" {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,135 @@
+package router
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+	"httpfromtcp/internal/server"
+)
+
+// serve runs a request through the router and returns the raw response, or
+// the error the router returned
+func serve(t *testing.T, rt *Router, rawRequest string) (string, error) {
+	req, err := request.RequestFromReader(strings.NewReader(rawRequest))
+	require.NoError(t, err)
+	buf := &bytes.Buffer{}
+	err = rt.Serve(response.NewWriter(buf), req)
+	return buf.String(), err
+}
+
+// reply returns a handler that answers with body followed by the path values
+func reply(body string, names ...string) server.Handler {
+	return func(w *response.Writer, req *request.Request) error {
+		res := body
+		for _, name := range names {
+			res += " " + name + "=" + req.PathValue(name)
+		}
+		w.WriteStatusLine(response.StatusOK)
+		w.WriteHeaders(response.GetDefaultHeaders(len(res)))
+		w.WriteBody([]byte(res))
+		return nil
+	}
+}
+
+// requireHandlerError checks that err is a *server.HandlerError with statusCode
+func requireHandlerError(t *testing.T, err error, statusCode response.StatusCode) *server.HandlerError {
+	handlerErr := &server.HandlerError{}
+	require.ErrorAs(t, err, &handlerErr)
+	assert.Equal(t, statusCode, handlerErr.StatusCode)
+	return handlerErr
+}
+
+func TestRouter(t *testing.T) {
+	rt := NewRouter()
+	rt.Get("/video", reply("video"))
+	rt.Get("/users/{id}", reply("user", "id"))
+	rt.Get("/users/me", reply("me"))
+	rt.Delete("/users/{id}", reply("deleted", "id"))
+	rt.Get("/files/{path...}", reply("file", "path"))
+	rt.Handle("", "/httpbin/", reply("httpbin"))
+
+	// Test: exact match
+	res, err := serve(t, rt, "GET /video HTTP/1.1\r\nHost: localhost:42069\r\n\r\n")
+	require.NoError(t, err)
+	assert.True(t, strings.HasSuffix(res, "\r\n\r\nvideo"))
+
+	// Test: query string is not part of the path
+	res, err = serve(t, rt, "GET /video?t=10 HTTP/1.1\r\nHost: localhost:42069\r\n\r\n")
+	require.NoError(t, err)
+	assert.True(t, strings.HasSuffix(res, "\r\n\r\nvideo"))
+
+	// Test: the path is matched decoded and with its dot-segments removed
+	res, err = serve(t, rt, "GET /files/../%76ideo HTTP/1.1\r\nHost: localhost:42069\r\n\r\n")
+	require.NoError(t, err)
+	assert.True(t, strings.HasSuffix(res, "\r\n\r\nvideo"))
+
+	// Test: an encoded slash doesn't end its segment
+	res, err = serve(t, rt, "GET /files/..%2Fvideo HTTP/1.1\r\nHost: localhost:42069\r\n\r\n")
+	require.NoError(t, err)
+	assert.True(t, strings.HasSuffix(res, "\r\n\r\nfile path=..%2Fvideo"))
+
+	// Test: nor can a literal "%2F" be taken for one
+	res, err = serve(t, rt, "GET /files/a%252Fb HTTP/1.1\r\nHost: localhost:42069\r\n\r\n")
+	require.NoError(t, err)
+	assert.True(t, strings.HasSuffix(res, "\r\n\r\nfile path=a%252Fb"))
+
+	// Test: parameter
+	res, err = serve(t, rt, "GET /users/42 HTTP/1.1\r\nHost: localhost:42069\r\n\r\n")
+	require.NoError(t, err)
+	assert.True(t, strings.HasSuffix(res, "\r\n\r\nuser id=42"))
+
+	// Test: literal segment wins over parameter
+	res, err = serve(t, rt, "GET /users/me HTTP/1.1\r\nHost: localhost:42069\r\n\r\n")
+	require.NoError(t, err)
+	assert.True(t, strings.HasSuffix(res, "\r\n\r\nme"))
+
+	// Test: routes are matched per method
+	res, err = serve(t, rt, "DELETE /users/42 HTTP/1.1\r\nHost: localhost:42069\r\n\r\n")
+	require.NoError(t, err)
+	assert.True(t, strings.HasSuffix(res, "\r\n\r\ndeleted id=42"))
+
+	// Test: wildcard
+	res, err = serve(t, rt, "GET /files/assets/vim.mp4 HTTP/1.1\r\nHost: localhost:42069\r\n\r\n")
+	require.NoError(t, err)
+	assert.True(t, strings.HasSuffix(res, "\r\n\r\nfile path=assets/vim.mp4"))
+
+	// Test: prefix with any method
+	res, err = serve(t, rt, "POST /httpbin/post HTTP/1.1\r\nHost: localhost:42069\r\n\r\n")
+	require.NoError(t, err)
+	assert.True(t, strings.HasSuffix(res, "\r\n\r\nhttpbin"))
+
+	// Test: empty parameter does not match
+	res, err = serve(t, rt, "GET /users/ HTTP/1.1\r\nHost: localhost:42069\r\n\r\n")
+	requireHandlerError(t, err, response.StatusNotFound)
+	assert.Equal(t, "", res)
+
+	// Test: unknown path
+	res, err = serve(t, rt, "GET /coffee HTTP/1.1\r\nHost: localhost:42069\r\n\r\n")
+	requireHandlerError(t, err, response.StatusNotFound)
+	assert.Equal(t, "", res)
+
+	// Test: known path with another method
+	_, err = serve(t, rt, "PUT /users/42 HTTP/1.1\r\nHost: localhost:42069\r\n\r\n")
+	handlerErr := requireHandlerError(t, err, response.StatusMethodNotAllowed)
+	assert.Equal(t, "DELETE, GET", handlerErr.Headers.Get("Allow"))
+
+	// Test: custom not found handler
+	rt.NotFound = reply("nothing here")
+	res, err = serve(t, rt, "GET /coffee HTTP/1.1\r\nHost: localhost:42069\r\n\r\n")
+	require.NoError(t, err)
+	assert.True(t, strings.HasSuffix(res, "\r\n\r\nnothing here"))
+}
+
+func TestInvalidPatterns(t *testing.T) {
+	rt := NewRouter()
+	assert.Panics(t, func() { rt.Get("video", reply("")) })
+	assert.Panics(t, func() { rt.Get("/users/{}", reply("")) })
+	assert.Panics(t, func() { rt.Get("/users/{id", reply("")) })
+	assert.Panics(t, func() { rt.Get("/files/{...}", reply("")) })
+}
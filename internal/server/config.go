@@ -0,0 +1,126 @@
+package server
+
+import (
+	"crypto/tls"
+	"log"
+	"net"
+	"time"
+
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+)
+
+const (
+	// how many requests are served on a single connection before closing it
+	defaultMaxRequestsPerConn = 100
+	// how many pipelined requests may be waiting for their response to be written
+	defaultMaxPipelineDepth = 16
+)
+
+// Timeouts bound how long each phase of a connection may take, so that slow or
+// stalled clients can't hold a connection forever. A zero duration disables
+// the timeout.
+type Timeouts struct {
+	// ReadHeader is the time allowed to read the request-line and headers
+	// once the first byte of a request arrived; a 408 is sent when it expires
+	ReadHeader time.Duration
+	// ReadBody is the time allowed to read the body once the headers are read
+	ReadBody time.Duration
+	// Write is the time allowed to write each response
+	Write time.Duration
+	// Idle is how long a keep-alive connection may wait for its next request
+	Idle time.Duration
+}
+
+var DefaultTimeouts = Timeouts{
+	ReadHeader: 10 * time.Second,
+	ReadBody:   60 * time.Second,
+	Write:      60 * time.Second,
+	Idle:       120 * time.Second,
+}
+
+// PanicHook is called with the request, the recovered value and the stack
+// trace when a handler panics
+type PanicHook func(req *request.Request, recovered any, stack []byte)
+
+// ErrorHandler writes the response for an error returned by a handler (or
+// produced by the server, e.g. a 400 for a malformed request, in which case
+// req is nil). The response hasn't been started when it is called.
+type ErrorHandler func(w *response.Writer, req *request.Request, err error)
+
+// Config describes how a Server listens and serves its connections. Only
+// Handler is required, every other zero value falls back to a default.
+type Config struct {
+	// Network and Address are passed to net.Listen by ListenAndServe, e.g.
+	// "tcp" and "127.0.0.1:42069". Network defaults to "tcp", Address to ":http".
+	Network string
+	Address string
+	// TLSConfig, if set, serves HTTPS by wrapping the listener with TLS
+	TLSConfig *tls.Config
+
+	Handler Handler
+
+	// Timeouts defaults to DefaultTimeouts
+	Timeouts *Timeouts
+	// MaxRequestsPerConn is how many requests are served on a connection
+	// before it is closed
+	MaxRequestsPerConn int
+	// MaxPipelineDepth is how many pipelined requests may be waiting for
+	// their response to be written
+	MaxPipelineDepth int
+	// Limits bound the size of requests, a 414, 431 or 413 is sent for those
+	// exceeding them. It defaults to request.DefaultLimits.
+	Limits *request.Limits
+	// LenientParsing accepts request-lines of legacy clients that don't follow
+	// the grammar strictly, header values with non-ASCII bytes (obs-text),
+	// and HTTP/1.1 requests without a Host header
+	LenientParsing bool
+
+	// Logger defaults to the standard logger
+	Logger *log.Logger
+	// ErrorRenderers render the error responses written by the default error
+	// handler, the one matching the request's Accept header is used, or the
+	// first one if none does. It defaults to plain text, HTML and JSON.
+	ErrorRenderers []ErrorRenderer
+	// ErrorHandler replaces the default rendering of errors entirely
+	ErrorHandler ErrorHandler
+
+	// OnPanic reports handler panics, e.g. to an error tracker. The server
+	// recovers from the panic whether or not it is set.
+	OnPanic PanicHook
+	// OnConnOpen and OnConnClose are called when a connection is accepted
+	// and once it is closed
+	OnConnOpen  func(conn net.Conn)
+	OnConnClose func(conn net.Conn)
+}
+
+// withDefaults returns a copy of the config with the defaults filled in
+func (c Config) withDefaults() Config {
+	if c.Network == "" {
+		c.Network = "tcp"
+	}
+	if c.Address == "" {
+		c.Address = ":http"
+	}
+	if c.Timeouts == nil {
+		timeouts := DefaultTimeouts
+		c.Timeouts = &timeouts
+	}
+	if c.Limits == nil {
+		limits := request.DefaultLimits
+		c.Limits = &limits
+	}
+	if c.MaxRequestsPerConn <= 0 {
+		c.MaxRequestsPerConn = defaultMaxRequestsPerConn
+	}
+	if c.MaxPipelineDepth <= 0 {
+		c.MaxPipelineDepth = defaultMaxPipelineDepth
+	}
+	if c.Logger == nil {
+		c.Logger = log.Default()
+	}
+	if len(c.ErrorRenderers) == 0 {
+		c.ErrorRenderers = defaultErrorRenderers
+	}
+	return c
+}
@@ -0,0 +1,251 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"os"
+	"strings"
+
+	"httpfromtcp/internal/headers"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+)
+
+// HandlerError is an error a handler returns to have the server answer with
+// the given status code and message
+type HandlerError struct {
+	StatusCode response.StatusCode
+	Message    string
+	// Headers are added to the error response, e.g. Allow on a 405
+	Headers *headers.Headers
+}
+
+func (e *HandlerError) Error() string {
+	return fmt.Sprintf("%d %s: %s", e.StatusCode, response.StatusText(e.StatusCode), e.Message)
+}
+
+// ErrorRenderer renders the body of error responses in one media type
+type ErrorRenderer interface {
+	// ContentType is the media type of the rendered body, e.g. "application/json"
+	ContentType() string
+	Render(statusCode response.StatusCode, message string) []byte
+}
+
+// TextErrorRenderer renders errors as plain text
+type TextErrorRenderer struct{}
+
+func (TextErrorRenderer) ContentType() string {
+	return "text/plain"
+}
+
+func (TextErrorRenderer) Render(statusCode response.StatusCode, message string) []byte {
+	return fmt.Appendf(nil, "%d %s\n%s\n", statusCode, response.StatusText(statusCode), message)
+}
+
+// HTMLErrorRenderer renders errors as a small HTML page
+type HTMLErrorRenderer struct{}
+
+func (HTMLErrorRenderer) ContentType() string {
+	return "text/html"
+}
+
+func (HTMLErrorRenderer) Render(statusCode response.StatusCode, message string) []byte {
+	title := html.EscapeString(fmt.Sprintf("%d %s", statusCode, response.StatusText(statusCode)))
+	body := "<html>\n\t<head>\n"
+	body += "\t\t<title>" + title + "</title>\n"
+	body += "\t</head>\n\t<body>\n"
+	body += "\t\t<h1>" + title + "</h1>\n"
+	body += "\t\t<p>" + html.EscapeString(message) + "</p>\n"
+	body += "\t</body>\n"
+	body += "</html>\n"
+	return []byte(body)
+}
+
+// JSONErrorRenderer renders errors as a JSON object
+type JSONErrorRenderer struct{}
+
+func (JSONErrorRenderer) ContentType() string {
+	return "application/json"
+}
+
+func (JSONErrorRenderer) Render(statusCode response.StatusCode, message string) []byte {
+	body, _ := json.Marshal(struct {
+		Status  int    `json:"status"`
+		Error   string `json:"error"`
+		Message string `json:"message"`
+	}{int(statusCode), response.StatusText(statusCode), message})
+	return append(body, '\n')
+}
+
+// defaultErrorRenderers are used unless Config.ErrorRenderers is set, plain
+// text being the fallback
+var defaultErrorRenderers = []ErrorRenderer{TextErrorRenderer{}, HTMLErrorRenderer{}, JSONErrorRenderer{}}
+
+// writeError answers the request with the status code and message of err. Any
+// error other than a *HandlerError is a 500 and its text is only logged, so
+// internal details don't leak to the client.
+func (s *Server) writeError(w *response.Writer, req *request.Request, err error) {
+	// a status line the handler gave before failing never reached the client
+	w.DiscardStatusLine()
+	if s.config.ErrorHandler != nil {
+		s.config.ErrorHandler(w, req, err)
+		return
+	}
+
+	handlerErr := &HandlerError{}
+	if isRequestError(err) {
+		// e.g. a body that failed to arrive, the connection can't be reused
+		w.SetKeepAlive(false)
+		handlerErr = requestError(err)
+	} else if !errors.As(err, &handlerErr) || handlerErr.StatusCode < 200 || !handlerErr.StatusCode.Valid() {
+		// including a *HandlerError whose status code can't end the response
+		s.config.Logger.Printf("error handling request: %v", err)
+		handlerErr = &HandlerError{
+			StatusCode: response.StatusInternalServerError,
+			Message:    "The server failed to handle the request.",
+		}
+	}
+
+	renderer := s.errorRenderer(req)
+	body := renderer.Render(handlerErr.StatusCode, handlerErr.Message)
+	h := response.GetDefaultHeaders(len(body))
+	h.Set("Content-Type", renderer.ContentType())
+	// the error's headers replace the defaults, keeping all their values
+	for key := range handlerErr.Headers.All() {
+		h.Del(key)
+	}
+	for key, value := range handlerErr.Headers.All() {
+		h.Add(key, value)
+	}
+	w.WriteStatusLine(handlerErr.StatusCode)
+	w.WriteHeaders(h)
+	w.WriteBody(body)
+}
+
+// isRequestError reports whether err comes from reading the request, which
+// handlers get when reading the body. Timeouts reading it are ParseErrors too,
+// unlike those of the handler's own connections.
+func isRequestError(err error) bool {
+	parseErr := &request.ParseError{}
+	return errors.As(err, &parseErr)
+}
+
+// requestError is the response to a request that could not be read
+func requestError(err error) *HandlerError {
+	switch {
+	case errors.Is(err, os.ErrDeadlineExceeded):
+		return &HandlerError{
+			StatusCode: response.StatusRequestTimeout,
+			Message:    "The request took too long to arrive.",
+		}
+	case errors.Is(err, request.ErrRequestLineTooLong):
+		return &HandlerError{
+			StatusCode: response.StatusURITooLong,
+			Message:    "The request-line is too long.",
+		}
+	case errors.Is(err, request.ErrHeadersTooLarge):
+		return &HandlerError{
+			StatusCode: response.StatusRequestHeaderFieldsTooLarge,
+			Message:    "The request headers are too large.",
+		}
+	case errors.Is(err, request.ErrBodyTooLarge):
+		return &HandlerError{
+			StatusCode: response.StatusContentTooLarge,
+			Message:    "The request body is too large.",
+		}
+	case errors.Is(err, request.ErrUnsupportedTransferEncoding):
+		return &HandlerError{
+			StatusCode: response.StatusNotImplemented,
+			Message:    "Only the chunked transfer coding is supported.",
+		}
+	case errors.Is(err, request.ErrUnsupportedVersion):
+		return &HandlerError{
+			StatusCode: response.StatusHTTPVersionNotSupported,
+			Message:    "Only HTTP/1.0 and HTTP/1.1 are supported.",
+		}
+	}
+	return &HandlerError{
+		StatusCode: response.StatusBadRequest,
+		Message:    "The request could not be parsed.",
+	}
+}
+
+// errorRenderer picks the first renderer whose media type is accepted by the
+// request, in the order of preference of its Accept header. A renderer is
+// excluded when the most specific media range matching it has "q=0", e.g.
+// text/plain by "text/plain;q=0, */*", and the fallback for a request that
+// accepts none of them is the first renderer that isn't excluded.
+func (s *Server) errorRenderer(req *request.Request) ErrorRenderer {
+	renderers := s.config.ErrorRenderers
+	if req == nil {
+		return renderers[0]
+	}
+
+	type acceptedRange struct {
+		mediaRange string
+		q          float64
+	}
+	ranges := []acceptedRange{}
+	for _, accepted := range req.Headers.QualityList("Accept") {
+		mediaRange, _, err := headers.ParseMediaType(accepted.Value)
+		if err != nil {
+			continue
+		}
+		ranges = append(ranges, acceptedRange{mediaRange, accepted.Q})
+	}
+	// excluded reports whether the most specific range matching the renderer
+	// marks it as not acceptable
+	excluded := func(renderer ErrorRenderer) bool {
+		specificity, q := -1, 1.0
+		for _, r := range ranges {
+			if mediaTypeMatches(r.mediaRange, renderer.ContentType()) && mediaRangeSpecificity(r.mediaRange) > specificity {
+				specificity, q = mediaRangeSpecificity(r.mediaRange), r.q
+			}
+		}
+		return q == 0
+	}
+
+	for _, r := range ranges {
+		if r.q == 0 {
+			continue
+		}
+		for _, renderer := range renderers {
+			if mediaTypeMatches(r.mediaRange, renderer.ContentType()) && !excluded(renderer) {
+				return renderer
+			}
+		}
+	}
+	for _, renderer := range renderers {
+		if !excluded(renderer) {
+			return renderer
+		}
+	}
+	// every renderer was refused, but the error still needs a body
+	return renderers[0]
+}
+
+// mediaRangeSpecificity ranks media ranges from the least specific, "*/*", to
+// the most specific, a full media type such as "text/html"
+func mediaRangeSpecificity(mediaRange string) int {
+	switch {
+	case mediaRange == "*/*":
+		return 0
+	case strings.HasSuffix(mediaRange, "/*"):
+		return 1
+	}
+	return 2
+}
+
+// mediaTypeMatches reports whether mediaType is within mediaRange, e.g.
+// "text/html" is within "text/html", "text/*" and "*/*"
+func mediaTypeMatches(mediaRange, mediaType string) bool {
+	if mediaRange == "*/*" || mediaRange == mediaType {
+		return true
+	}
+	if prefix, ok := strings.CutSuffix(mediaRange, "/*"); ok {
+		return strings.HasPrefix(mediaType, prefix+"/")
+	}
+	return false
+}
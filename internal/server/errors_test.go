@@ -0,0 +1,104 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"httpfromtcp/internal/headers"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+)
+
+func TestHandlerErrorResponses(t *testing.T) {
+	notFound := func(w *response.Writer, req *request.Request) error {
+		return &HandlerError{StatusCode: response.StatusNotFound, Message: "No coffee <here>."}
+	}
+	run := func(config Config, handler Handler, accept string) string {
+		raw := "GET /coffee HTTP/1.1\r\nHost: localhost:42069\r\n"
+		if accept != "" {
+			raw += "Accept: " + accept + "\r\n"
+		}
+		req, err := request.RequestFromReader(strings.NewReader(raw + "\r\n"))
+		require.NoError(t, err)
+		buf := &bytes.Buffer{}
+		config.Handler = handler
+		newServer(nil, true, config).runHandler(response.NewWriter(buf), req)
+		return buf.String()
+	}
+	config := Config{}
+
+	// Test: plain text without an Accept header
+	res := run(config, notFound, "")
+	assert.True(t, strings.HasPrefix(res, "HTTP/1.1 404 Not Found\r\n"))
+	assert.Contains(t, res, "Content-Type: text/plain\r\n")
+	assert.True(t, strings.HasSuffix(res, "\r\n\r\n404 Not Found\nNo coffee <here>.\n"))
+
+	// Test: JSON
+	res = run(config, notFound, "application/json")
+	assert.Contains(t, res, "Content-Type: application/json\r\n")
+	assert.True(t, strings.HasSuffix(res, `{"status":404,"error":"Not Found","message":"No coffee \u003chere\u003e."}`+"\n"))
+
+	// Test: HTML is escaped
+	res = run(config, notFound, "text/html;q=0.9, */*;q=0.8")
+	assert.Contains(t, res, "Content-Type: text/html\r\n")
+	assert.Contains(t, res, "<p>No coffee &lt;here&gt;.</p>")
+
+	// Test: media ranges with q=0 are skipped
+	res = run(config, notFound, "application/json;q=0, text/*")
+	assert.Contains(t, res, "Content-Type: text/plain\r\n")
+
+	// Test: a media type refused with q=0 isn't matched by a wildcard
+	res = run(config, notFound, "text/plain;q=0, */*")
+	assert.Contains(t, res, "Content-Type: text/html\r\n")
+	res = run(config, notFound, "text/*;q=0, text/html, */*;q=0.1")
+	assert.Contains(t, res, "Content-Type: text/html\r\n")
+
+	// Test: the fallback skips the refused media types
+	res = run(config, notFound, "text/plain;q=0, image/png")
+	assert.Contains(t, res, "Content-Type: text/html\r\n")
+
+	// Test: media ranges are tried by decreasing weight
+	res = run(config, notFound, "text/html;q=0.5, application/json")
+	assert.Contains(t, res, "Content-Type: application/json\r\n")
+
+	// Test: extra headers of the error
+	res = run(config, func(w *response.Writer, req *request.Request) error {
+		h := headers.NewHeaders()
+		h.Set("Allow", "GET")
+		return &HandlerError{StatusCode: response.StatusMethodNotAllowed, Message: "Nope.", Headers: h}
+	}, "")
+	assert.True(t, strings.HasPrefix(res, "HTTP/1.1 405 Method Not Allowed\r\n"))
+	assert.Contains(t, res, "Allow: GET\r\n")
+
+	// Test: other errors are a 500 that doesn't leak their message
+	res = run(config, func(w *response.Writer, req *request.Request) error {
+		return errors.New("database password is hunter2")
+	}, "")
+	assert.True(t, strings.HasPrefix(res, "HTTP/1.1 500 Internal Server Error\r\n"))
+	assert.NotContains(t, res, "hunter2")
+
+	// Test: timeouts of the handler's own connections aren't request timeouts
+	res = run(config, func(w *response.Writer, req *request.Request) error {
+		return fmt.Errorf("upstream: %w", os.ErrDeadlineExceeded)
+	}, "")
+	assert.True(t, strings.HasPrefix(res, "HTTP/1.1 500 Internal Server Error\r\n"))
+	assert.NotContains(t, res, "Connection: close")
+
+	// Test: custom renderers
+	res = run(Config{ErrorRenderers: []ErrorRenderer{JSONErrorRenderer{}}}, notFound, "text/html")
+	assert.Contains(t, res, "Content-Type: application/json\r\n")
+
+	// Test: custom error handler
+	res = run(Config{ErrorHandler: func(w *response.Writer, req *request.Request, err error) {
+		w.WriteStatusLine(response.StatusCode(418))
+		w.WriteHeaders(response.GetDefaultHeaders(0))
+	}}, notFound, "")
+	assert.True(t, strings.HasPrefix(res, "HTTP/1.1 418 \r\n"))
+}
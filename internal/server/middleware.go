@@ -0,0 +1,40 @@
+package server
+
+import (
+	"time"
+
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+)
+
+// Middleware wraps a Handler to add behaviour around it (logging, auth,
+// recovery, ...) without changing the handler itself. Middleware can observe
+// the response through the writer's hooks and accessors.
+type Middleware func(Handler) Handler
+
+// Chain wraps handler with middlewares. The first middleware is the outermost
+// one, so it sees the request first and the finished response last.
+func Chain(handler Handler, middlewares ...Middleware) Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler
+}
+
+// Logger logs the method, target, status code, body size and duration of
+// every request, to the logger of the response writer, which the server sets
+// to Config.Logger
+func Logger(next Handler) Handler {
+	return func(w *response.Writer, req *request.Request) error {
+		start := time.Now()
+		err := next(w, req)
+		if err != nil {
+			w.Logger().Printf("%s %s error: %v %v", req.RequestLine.Method, req.RequestLine.RequestTarget,
+				err, time.Since(start))
+			return err
+		}
+		w.Logger().Printf("%s %s %d %dB %v", req.RequestLine.Method, req.RequestLine.RequestTarget,
+			w.StatusCode(), w.BytesWritten(), time.Since(start))
+		return nil
+	}
+}
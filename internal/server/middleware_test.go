@@ -0,0 +1,66 @@
+package server
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"httpfromtcp/internal/headers"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+)
+
+func TestChain(t *testing.T) {
+	calls := []string{}
+	trace := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return func(w *response.Writer, req *request.Request) error {
+				calls = append(calls, name+" before")
+				w.OnWriteHeaders(func(statusCode response.StatusCode, h *headers.Headers) {
+					h.Add("X-Middleware", name)
+				})
+				err := next(w, req)
+				calls = append(calls, name+" after")
+				return err
+			}
+		}
+	}
+	handler := func(w *response.Writer, req *request.Request) error {
+		calls = append(calls, "handler")
+		w.WriteStatusLine(response.StatusOK)
+		w.WriteHeaders(response.GetDefaultHeaders(0))
+		return nil
+	}
+
+	req, err := request.RequestFromReader(strings.NewReader("GET / HTTP/1.1\r\nHost: localhost:42069\r\n\r\n"))
+	require.NoError(t, err)
+	buf := &bytes.Buffer{}
+	err = Chain(handler, trace("outer"), trace("inner"))(response.NewWriter(buf), req)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"outer before", "inner before", "handler", "inner after", "outer after"}, calls)
+	assert.Contains(t, buf.String(), "X-Middleware: outer\r\nX-Middleware: inner\r\n")
+}
+
+func TestLogger(t *testing.T) {
+	handler := func(w *response.Writer, req *request.Request) error {
+		w.WriteStatusLine(response.StatusOK)
+		w.WriteHeaders(response.GetDefaultHeaders(2))
+		w.WriteBody([]byte("ok"))
+		return nil
+	}
+
+	req, err := request.RequestFromReader(strings.NewReader("GET /coffee HTTP/1.1\r\nHost: localhost:42069\r\n\r\n"))
+	require.NoError(t, err)
+	// requests are logged to the writer's logger, which the server sets to
+	// Config.Logger
+	logs := &bytes.Buffer{}
+	w := response.NewWriter(&bytes.Buffer{})
+	w.SetLogger(log.New(logs, "", 0))
+	require.NoError(t, Chain(handler, Logger)(w, req))
+	assert.True(t, strings.HasPrefix(logs.String(), "GET /coffee 200 2B "))
+}
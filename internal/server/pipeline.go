@@ -0,0 +1,100 @@
+package server
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"httpfromtcp/internal/response"
+)
+
+// pipelinedResponse is the destination of one response on a connection that
+// may have several requests in flight. Until it reaches the head of the queue
+// everything the handler writes is buffered; once activated the buffer is
+// flushed and further writes go straight to the connection, so the response
+// at the head can still be streamed.
+type pipelinedResponse struct {
+	mu     sync.Mutex
+	conn   io.Writer
+	buf    bytes.Buffer
+	active bool
+	err    error // first error writing to the connection
+
+	writer *response.Writer
+	done   chan struct{} // closed once the handler has returned
+}
+
+// newPipelinedResponse returns a response to be written to conn, whose writer
+// logs its errors to logger
+func newPipelinedResponse(conn io.Writer, logger *log.Logger) *pipelinedResponse {
+	res := &pipelinedResponse{
+		conn: conn,
+		done: make(chan struct{}),
+	}
+	res.writer = response.NewWriter(res)
+	res.writer.SetLogger(logger)
+	return res
+}
+
+func (p *pipelinedResponse) Write(data []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.active {
+		return p.buf.Write(data)
+	}
+	if p.err != nil {
+		return 0, p.err
+	}
+	n, err := p.conn.Write(data)
+	if err != nil {
+		p.err = err
+	}
+	return n, err
+}
+
+// activate moves the response to the head of the queue, failing to flush the
+// buffer is reported to logger
+func (p *pipelinedResponse) activate(logger *log.Logger) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.active = true
+	if p.buf.Len() == 0 {
+		return
+	}
+	if _, err := p.conn.Write(p.buf.Bytes()); err != nil {
+		logger.Printf("error writing response: %v", err)
+		p.err = err
+	}
+	p.buf.Reset()
+}
+
+// finish marks the handler as done with the response
+func (p *pipelinedResponse) finish() {
+	close(p.done)
+}
+
+// writeResponses hands the connection to each queued response in request
+// order, waiting for its handler to finish before moving to the next one, and
+// calls written once it is complete. Each response gets writeTimeout to be
+// written. If a response closes the connection the rest of the queue is
+// discarded. Write errors are reported to logger.
+func writeResponses(conn net.Conn, queue <-chan *pipelinedResponse, writeTimeout time.Duration, logger *log.Logger, written func()) {
+	for res := range queue {
+		conn.SetWriteDeadline(deadline(writeTimeout))
+		res.activate(logger)
+		<-res.done
+		written()
+		if !res.writer.KeepAlive() || res.err != nil {
+			conn.Close()
+			break
+		}
+	}
+	// unblock the reader until it notices the connection is gone
+	for range queue {
+	}
+}
@@ -0,0 +1,36 @@
+package server
+
+import (
+	"bytes"
+	"log"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"httpfromtcp/internal/response"
+)
+
+func TestWriteResponsesLogger(t *testing.T) {
+	client, conn := net.Pipe()
+	// the client is gone, so flushing the buffered response fails
+	client.Close()
+
+	logs := &bytes.Buffer{}
+	logger := log.New(logs, "", 0)
+	res := newPipelinedResponse(conn, logger)
+	res.writer.WriteStatusLine(response.StatusOK)
+	res.writer.WriteHeaders(response.GetDefaultHeaders(0))
+	// so are the errors of the handler's writer
+	res.writer.WriteHeaders(response.GetDefaultHeaders(0))
+	res.finish()
+	queue := make(chan *pipelinedResponse, 1)
+	queue <- res
+	close(queue)
+
+	writeResponses(conn, queue, 0, logger, func() {})
+	require.Error(t, res.err)
+	assert.Contains(t, logs.String(), "error writing response")
+	assert.Contains(t, logs.String(), "cannot write the headers")
+}
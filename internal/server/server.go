@@ -1,56 +1,204 @@
 package server
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
-	"log"
+	"io"
 	"net"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
 
+	"httpfromtcp/internal/headers"
 	"httpfromtcp/internal/request"
 	"httpfromtcp/internal/response"
 	"sync/atomic"
 )
 
-type HandlerError struct {
-	StatusCode response.StatusCode
-	Message string
-}
+// how often Shutdown checks whether the connections are done
+const shutdownPollInterval = 20 * time.Millisecond
 
-type Handler func(w *response.Writer, req *request.Request)
+// Handler writes the response to a request. If it returns an error without
+// having written anything, the server answers with an error response instead:
+// a *HandlerError sets its status code and message, an error reading req.Body
+// gets the matching 4xx (e.g. 413 for a body too large), any other is a 500.
+// A handler that only writes a status line gets it sent with an empty body.
+type Handler func(w *response.Writer, req *request.Request) error
 
 type Server struct {
 	started atomic.Bool // false: not started, true: started
 	listener net.Listener
-	handler Handler
+	config   Config
+
+	inShutdown atomic.Bool
+	mu         sync.Mutex
+	conns      map[net.Conn]*connState // open connections
+}
+
+// connState tracks what a connection is doing so Shutdown can tell the idle
+// ones apart
+type connState struct {
+	// requests read from the connection whose response is not fully written
+	inFlight atomic.Int32
+	// blocked waiting for the next request to start arriving
+	waiting atomic.Bool
 }
 
 func NewServer(listener net.Listener, started bool, handler Handler) *Server {
+	return newServer(listener, started, Config{Handler: handler})
+}
+
+func newServer(listener net.Listener, started bool, config Config) *Server {
 	server := &Server{
 		listener: listener,
-		handler: handler,
+		config:   config.withDefaults(),
+		conns:    map[net.Conn]*connState{},
 	}
 
 	server.started.Store(started)
 	return server
 }
 
-func Serve(port int, handler Handler) (*Server, error) {
-	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+// ListenAndServe listens on config.Network and config.Address and serves the
+// accepted connections in the background until the server is closed.
+func ListenAndServe(config Config) (*Server, error) {
+	config = config.withDefaults()
+	listener, err := net.Listen(config.Network, config.Address)
 	if err != nil {
 		return nil, err
 	}
+	return ServeListener(listener, config), nil
+}
 
-	server := NewServer(listener, true, handler)
+// ServeListener serves the connections accepted by an existing listener in
+// the background until the server is closed. The listener is wrapped with TLS
+// if config.TLSConfig is set.
+func ServeListener(listener net.Listener, config Config) *Server {
+	if config.TLSConfig != nil {
+		listener = tls.NewListener(listener, config.TLSConfig)
+	}
+	server := newServer(listener, true, config)
 
 	go server.listen()
-	return server, nil
+	return server
 }
 
+// Serve listens on the given TCP port of every interface, see ListenAndServe
+// to configure anything else.
+func Serve(port int, handler Handler) (*Server, error) {
+	return ListenAndServe(Config{
+		Address: fmt.Sprintf(":%d", port),
+		Handler: handler,
+	})
+}
+
+// ServeConn serves a single connection until it is closed, blocking until
+// then. It is useful to serve connections accepted elsewhere, or a net.Pipe.
+func (s *Server) ServeConn(conn net.Conn) {
+	state := s.trackConn(conn)
+	if state == nil {
+		conn.Close()
+		return
+	}
+	s.handle(conn, state)
+}
+
+// Close stops the server immediately, closing the listener and every open
+// connection, even those in the middle of a request. See Shutdown for a
+// graceful alternative.
 func (s *Server) Close() error {
 	// Set started to false to signal shutdown
 	s.started.Store(false)
+	s.inShutdown.Store(true)
+	err := s.closeListener()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	return err
+}
+
+// Shutdown stops the server gracefully: it stops accepting connections, closes
+// the idle keep-alive ones and waits for the active ones to finish their
+// in-flight requests. If ctx expires first, the remaining connections are
+// closed forcibly and the context's error is returned.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.started.Store(false)
+	s.inShutdown.Store(true)
+	err := s.closeListener()
+
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+	for {
+		if s.closeIdleConns() {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			s.mu.Lock()
+			for conn := range s.conns {
+				conn.Close()
+			}
+			s.mu.Unlock()
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// closeListener closes the listener, if the server has one
+func (s *Server) closeListener() error {
+	if s.listener == nil {
+		return nil
+	}
 	return s.listener.Close()
 }
 
+// closeIdleConns closes the connections waiting for their next request
+// without requests in flight, and reports whether no connection is left open.
+// A connection whose request has started arriving isn't idle, even if its
+// headers are still being read.
+func (s *Server) closeIdleConns() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn, state := range s.conns {
+		if state.waiting.Load() && state.inFlight.Load() == 0 {
+			conn.Close()
+		}
+	}
+	return len(s.conns) == 0
+}
+
+// trackConn registers a new connection, it returns nil if the server is
+// shutting down and the connection should be dropped
+func (s *Server) trackConn(conn net.Conn) *connState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.inShutdown.Load() {
+		return nil
+	}
+	state := &connState{}
+	s.conns[conn] = state
+	if s.config.OnConnOpen != nil {
+		s.config.OnConnOpen(conn)
+	}
+	return state
+}
+
+func (s *Server) untrackConn(conn net.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.conns, conn)
+	if s.config.OnConnClose != nil {
+		s.config.OnConnClose(conn)
+	}
+}
+
 func (s *Server) listen() {
 	for s.started.Load() {
 		conn, err := s.listener.Accept()
@@ -58,26 +206,202 @@ func (s *Server) listen() {
 			if !s.started.Load() {
 				return
 			}
-			log.Printf("Error accepting connection: %v", err)
+			s.config.Logger.Printf("Error accepting connection: %v", err)
 			continue
 		}
-		go s.handle(conn)
+		// tracked before the goroutine starts, so Shutdown can't miss it
+		state := s.trackConn(conn)
+		if state == nil {
+			conn.Close()
+			return
+		}
+		go s.handle(conn, state)
 	}
 }
 
-func (s *Server) handle(conn net.Conn)  {
+func (s *Server) handle(conn net.Conn, state *connState) {
+	defer s.untrackConn(conn)
 	defer conn.Close()
+	// handlers of responses discarded after the connection closed may still be
+	// running, the connection only counts as done once they return
+	handlers := sync.WaitGroup{}
+	defer handlers.Wait()
 
-	responseWriter := response.NewWriter(conn)
-	headers := response.GetDefaultHeaders(0)
-	req, err := request.RequestFromReader(conn)
-	if err != nil {
-		responseWriter.WriteStatusLine(response.StatusBadRequest)
-		responseWriter.WriteHeaders(headers)
+	// handlers of pipelined requests run concurrently, but their responses are
+	// queued and written to the connection in the order the requests arrived
+	queue := make(chan *pipelinedResponse, s.config.MaxPipelineDepth)
+	writerDone := make(chan struct{})
+	timeouts := s.config.Timeouts
+	go func() {
+		defer close(writerDone)
+		writeResponses(conn, queue, timeouts.Write, s.config.Logger, func() { state.inFlight.Add(-1) })
+	}()
+	defer func() {
+		close(queue)
+		<-writerDone
+	}()
+
+	reader := request.NewReader(conn)
+	reader.Limits = *s.config.Limits
+	reader.Lenient = s.config.LenientParsing
+	// serve requests on the same connection until either side asks to close it
+	for served := 1; !s.inShutdown.Load(); served++ {
+		conn.SetReadDeadline(deadline(timeouts.Idle))
+		state.waiting.Store(true)
+		err := reader.WaitForRequest()
+		state.waiting.Store(false)
+		if err != nil {
+			// the client closed the connection, stayed idle for too long, or a
+			// response already closed it
+			return
+		}
+
+		conn.SetReadDeadline(deadline(timeouts.ReadHeader))
+		req, err := reader.ReadRequest()
+		if err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, net.ErrClosed) {
+				return
+			}
+			parseErr := &request.ParseError{}
+			if errors.As(err, &parseErr) {
+				s.config.Logger.Printf("error reading request from %v: %v", conn.RemoteAddr(), parseErr)
+			}
+			res := newPipelinedResponse(conn, s.config.Logger)
+			res.writer.SetKeepAlive(false)
+			s.writeError(res.writer, nil, requestError(err))
+			res.finish()
+			state.inFlight.Add(1)
+			queue <- res
+			return
+		}
+		// the handler reads the body from the connection
+		conn.SetReadDeadline(deadline(timeouts.ReadBody))
+
+		res := newPipelinedResponse(conn, s.config.Logger)
+		res.writer.SetRequestVersion(req.RequestLine.HttpVersion)
+		closing := !keepAlive(req) || served >= s.config.MaxRequestsPerConn || s.inShutdown.Load()
+		if closing {
+			res.writer.SetKeepAlive(false)
+		}
+		if req.ExpectsContinue() {
+			// sent once the handler reads the body, so that it can reject it
+			// without the client sending it
+			res.writer.ExpectContinue()
+			req.SetContinueHook(res.writer.WriteContinue)
+		}
+		state.inFlight.Add(1)
+		queue <- res
+
+		handlers.Add(1)
+		go func() {
+			defer handlers.Done()
+			defer res.finish()
+			s.runHandler(res.writer, req)
+		}()
+
+		if closing {
+			return
+		}
+		// the next request can only be read once the body is out of the way,
+		// whatever the handler left unread of it is discarded
+		select {
+		case <-req.BodyDone():
+		case <-res.done:
+			if !res.writer.KeepAlive() {
+				// e.g. the body of a rejected 100-continue request, which the
+				// client may never send
+				return
+			}
+		}
+		if _, err := io.Copy(io.Discard, req.Body); err != nil {
+			return
+		}
+	}
+}
+
+// runHandler calls the handler, recovering from a panic so that it only
+// takes down its own connection instead of the whole process
+func (s *Server) runHandler(w *response.Writer, req *request.Request) {
+	defer func() {
+		recovered := recover()
+		if recovered == nil {
+			return
+		}
+		stack := debug.Stack()
+		s.config.Logger.Printf("panic serving %s %s: %v\n%s", req.RequestLine.Method, req.RequestLine.RequestTarget, recovered, stack)
+		if s.config.OnPanic != nil {
+			s.config.OnPanic(req, recovered, stack)
+		}
+
+		// the response may have been cut short, so the connection can't be reused
+		w.SetKeepAlive(false)
+		if !w.Written() {
+			s.writeError(w, req, fmt.Errorf("panic: %v", recovered))
+		}
+	}()
+
+	// HTTP/1.0 predates Expect, it is ignored
+	expect := req.Headers.Get("Expect")
+	if req.RequestLine.HttpVersion == "1.1" && expect != "" && !strings.EqualFold(expect, "100-continue") {
+		// the body may follow, the connection can't be reused
+		w.SetKeepAlive(false)
+		s.writeError(w, req, &HandlerError{
+			StatusCode: response.StatusExpectationFailed,
+			Message:    fmt.Sprintf("The expectation %q is not supported.", expect),
+		})
 		return
 	}
 
-	s.handler(responseWriter, req)
+	err := s.config.Handler(w, req)
+	if err != nil {
+		if w.Written() {
+			// too late to send an error response, the client can only tell
+			// something went wrong by the connection closing
+			s.config.Logger.Printf("error after the response was started: %v", err)
+			w.SetKeepAlive(false)
+			return
+		}
+		s.writeError(w, req, err)
+		return
+	}
+	// a handler that returns without writing anything still owes the client a
+	// response
+	if !w.Written() && w.StatusCode() != 0 {
+		// only the status line was given, it is sent with an empty body
+		h := headers.NewHeaders()
+		if code := w.StatusCode(); code != response.StatusNoContent && code != response.StatusNotModified {
+			h.Set("Content-Length", "0")
+		}
+		w.WriteHeaders(h)
+		return
+	}
+	if !w.Written() {
+		s.writeError(w, req, fmt.Errorf("handler for %s %s wrote no response", req.RequestLine.Method, req.RequestLine.RequestTarget))
+		return
+	}
+	// a chunked body left open would swallow the next response on the
+	// connection, so it is ended here, or the connection closed if it can't be
+	if err := w.Finish(); err != nil {
+		s.config.Logger.Printf("error finishing the response to %s %s: %v", req.RequestLine.Method, req.RequestLine.RequestTarget, err)
+		w.SetKeepAlive(false)
+	}
 }
 
+// keepAlive reports whether the client wants the connection kept open after
+// the request: HTTP/1.1 connections are persistent unless "Connection: close"
+// is sent, HTTP/1.0 ones only with "Connection: keep-alive"
+func keepAlive(req *request.Request) bool {
+	if req.RequestLine.HttpVersion == "1.0" {
+		return req.Headers.HasToken("Connection", "keep-alive")
+	}
+	return !req.Headers.HasToken("Connection", "close")
+}
 
+// deadline returns the deadline for a timeout starting now, or the zero time
+// (no deadline) if the timeout is disabled
+func deadline(timeout time.Duration) time.Time {
+	if timeout <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(timeout)
+}
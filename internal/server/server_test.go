@@ -0,0 +1,583 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"httpfromtcp/internal/headers"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+)
+
+func TestPipelinedResponsesInOrder(t *testing.T) {
+	// the first request takes the longest, so the handlers finish in reverse order
+	delays := map[string]time.Duration{
+		"/first":  60 * time.Millisecond,
+		"/second": 30 * time.Millisecond,
+		"/third":  0,
+	}
+	handler := func(w *response.Writer, req *request.Request) error {
+		time.Sleep(delays[req.RequestLine.RequestTarget])
+		body := req.RequestLine.RequestTarget
+		w.WriteStatusLine(response.StatusOK)
+		w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+		w.WriteBody([]byte(body))
+		return nil
+	}
+
+	client, conn := net.Pipe()
+	s := newServer(nil, true, Config{Handler: handler})
+	go s.ServeConn(conn)
+
+	go client.Write([]byte(
+		"GET /first HTTP/1.1\r\nHost: localhost:42069\r\n\r\n" +
+			"GET /second HTTP/1.1\r\nHost: localhost:42069\r\n\r\n" +
+			"GET /third HTTP/1.1\r\nHost: localhost:42069\r\nConnection: close\r\n\r\n",
+	))
+
+	client.SetReadDeadline(time.Now().Add(5 * time.Second))
+	data, err := io.ReadAll(client)
+	require.NoError(t, err)
+
+	responses := string(data)
+	first := strings.Index(responses, "\r\n\r\n/first")
+	second := strings.Index(responses, "\r\n\r\n/second")
+	third := strings.Index(responses, "\r\n\r\n/third")
+	require.NotEqual(t, -1, first)
+	require.NotEqual(t, -1, second)
+	require.NotEqual(t, -1, third)
+	assert.Less(t, first, second)
+	assert.Less(t, second, third)
+	assert.Equal(t, 3, strings.Count(responses, "HTTP/1.1 200 OK"))
+	assert.Equal(t, 1, strings.Count(responses, "Connection: close"))
+}
+
+func TestRequestBody(t *testing.T) {
+	// echoes the body of /echo, ignores the others
+	handler := func(w *response.Writer, req *request.Request) error {
+		body := []byte{}
+		if req.RequestLine.RequestTarget == "/echo" {
+			var err error
+			if body, err = req.ReadBody(); err != nil {
+				return err
+			}
+		}
+		w.WriteStatusLine(response.StatusOK)
+		w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+		w.WriteBody(body)
+		return nil
+	}
+
+	client, conn := net.Pipe()
+	s := newServer(nil, true, Config{Handler: handler})
+	go s.ServeConn(conn)
+
+	// the unread body of the first request must not be taken for a request
+	go client.Write([]byte(
+		"POST /ignore HTTP/1.1\r\nHost: localhost:42069\r\nContent-Length: 19\r\n\r\nGET /ignored HTTP/1" +
+			"POST /echo HTTP/1.1\r\nHost: localhost:42069\r\nTransfer-Encoding: chunked\r\nConnection: close\r\n\r\n" +
+			"6\r\nhello \r\n6\r\nworld!\r\n0\r\n\r\n",
+	))
+
+	client.SetReadDeadline(time.Now().Add(5 * time.Second))
+	data, err := io.ReadAll(client)
+	require.NoError(t, err)
+	responses := string(data)
+	assert.Equal(t, 2, strings.Count(responses, "HTTP/1.1 200 OK"))
+	assert.True(t, strings.HasSuffix(responses, "\r\n\r\nhello world!"))
+}
+
+func TestExpectContinue(t *testing.T) {
+	// rejects bodies over 16 bytes without reading them, echoes the others
+	handler := func(w *response.Writer, req *request.Request) error {
+		if contentLength, _ := strconv.Atoi(req.Headers.Get("Content-Length")); contentLength > 16 {
+			return &HandlerError{StatusCode: response.StatusContentTooLarge, Message: "Too large."}
+		}
+		body, err := req.ReadBody()
+		if err != nil {
+			return err
+		}
+		w.WriteStatusLine(response.StatusOK)
+		w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+		w.WriteBody(body)
+		return nil
+	}
+	s := newServer(nil, true, Config{Handler: handler})
+
+	// Test: the body is only sent once the server asks for it
+	client, conn := net.Pipe()
+	go s.ServeConn(conn)
+	client.SetDeadline(time.Now().Add(5 * time.Second))
+	go client.Write([]byte("POST / HTTP/1.1\r\nHost: localhost:42069\r\nContent-Length: 6\r\nExpect: 100-continue\r\n\r\n"))
+	interim := make([]byte, len("HTTP/1.1 100 Continue\r\n\r\n"))
+	_, err := io.ReadFull(client, interim)
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 100 Continue\r\n\r\n", string(interim))
+	go client.Write([]byte("hello!" + "GET / HTTP/1.1\r\nHost: localhost:42069\r\nConnection: close\r\n\r\n"))
+	data, err := io.ReadAll(client)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(data), "HTTP/1.1 200 OK\r\n"))
+	assert.Contains(t, string(data), "\r\n\r\nhello!HTTP/1.1 200 OK\r\n")
+
+	// Test: a rejected body is never asked for, the connection is closed instead
+	client, conn = net.Pipe()
+	go s.ServeConn(conn)
+	client.SetDeadline(time.Now().Add(5 * time.Second))
+	go client.Write([]byte("POST / HTTP/1.1\r\nHost: localhost:42069\r\nContent-Length: 1000\r\nExpect: 100-continue\r\n\r\n"))
+	data, err = io.ReadAll(client)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(data), "HTTP/1.1 413 Content Too Large\r\n"))
+	assert.Contains(t, string(data), "Connection: close\r\n")
+	assert.NotContains(t, string(data), "100 Continue")
+
+	// Test: unknown expectations fail
+	client, conn = net.Pipe()
+	go s.ServeConn(conn)
+	client.SetDeadline(time.Now().Add(5 * time.Second))
+	go client.Write([]byte("POST / HTTP/1.1\r\nHost: localhost:42069\r\nContent-Length: 6\r\nExpect: coffee\r\n\r\n"))
+	data, err = io.ReadAll(client)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(data), "HTTP/1.1 417 Expectation Failed\r\n"))
+}
+
+func TestHTTP10(t *testing.T) {
+	handler := func(w *response.Writer, req *request.Request) error {
+		w.WriteStatusLine(response.StatusOK)
+		w.WriteHeaders(response.GetDefaultHeaders(2))
+		w.WriteBody([]byte("ok"))
+		return nil
+	}
+	s := newServer(nil, true, Config{Handler: handler})
+
+	// Test: the connection is closed after the response by default
+	client, conn := net.Pipe()
+	go s.ServeConn(conn)
+	go client.Write([]byte("GET / HTTP/1.0\r\n\r\nGET / HTTP/1.0\r\n\r\n"))
+	client.SetReadDeadline(time.Now().Add(5 * time.Second))
+	data, err := io.ReadAll(client)
+	require.NoError(t, err)
+	assert.Equal(t, 1, strings.Count(string(data), "HTTP/1.1 200 OK\r\n"))
+	assert.Contains(t, string(data), "Connection: close\r\n")
+
+	// Test: unless the client asks for keep-alive
+	client, conn = net.Pipe()
+	go s.ServeConn(conn)
+	go client.Write([]byte("GET / HTTP/1.0\r\nConnection: keep-alive\r\n\r\nGET / HTTP/1.0\r\n\r\n"))
+	client.SetReadDeadline(time.Now().Add(5 * time.Second))
+	data, err = io.ReadAll(client)
+	require.NoError(t, err)
+	assert.Equal(t, 2, strings.Count(string(data), "HTTP/1.1 200 OK\r\n"))
+	assert.Equal(t, 1, strings.Count(string(data), "Connection: keep-alive\r\n"))
+}
+
+func TestHandlerWithoutResponse(t *testing.T) {
+	handler := func(w *response.Writer, req *request.Request) error { return nil }
+
+	client, conn := net.Pipe()
+	s := newServer(nil, true, Config{Handler: handler})
+	go s.ServeConn(conn)
+
+	go client.Write([]byte("GET / HTTP/1.1\r\nHost: localhost:42069\r\nConnection: close\r\n\r\n"))
+
+	client.SetReadDeadline(time.Now().Add(5 * time.Second))
+	data, err := io.ReadAll(client)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(data), "HTTP/1.1 500 Internal Server Error"))
+}
+
+func TestHandlerWithStatusLineOnly(t *testing.T) {
+	handler := func(w *response.Writer, req *request.Request) error {
+		if req.RequestLine.RequestTarget == "/empty" {
+			w.WriteStatusLine(response.StatusNoContent)
+			return nil
+		}
+		w.WriteStatusLine(response.StatusCreated)
+		return nil
+	}
+
+	client, conn := net.Pipe()
+	s := newServer(nil, true, Config{Handler: handler})
+	go s.ServeConn(conn)
+
+	// every pipelined request still gets its own response
+	go client.Write([]byte(
+		"GET /empty HTTP/1.1\r\nHost: localhost:42069\r\n\r\n" +
+			"GET /created HTTP/1.1\r\nHost: localhost:42069\r\nConnection: close\r\n\r\n",
+	))
+
+	client.SetReadDeadline(time.Now().Add(5 * time.Second))
+	data, err := io.ReadAll(client)
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 204 No Content\r\n\r\n"+
+		"HTTP/1.1 201 Created\r\nContent-Length: 0\r\nConnection: close\r\n\r\n", string(data))
+}
+
+func TestHandlerWithInterimStatus(t *testing.T) {
+	handler := func(w *response.Writer, req *request.Request) error {
+		if req.RequestLine.RequestTarget == "/error" {
+			return &HandlerError{StatusCode: response.StatusContinue}
+		}
+		w.WriteStatusLine(response.StatusContinue)
+		w.WriteHeaders(headers.NewHeaders())
+		return nil
+	}
+
+	client, conn := net.Pipe()
+	s := newServer(nil, true, Config{Handler: handler})
+	go s.ServeConn(conn)
+
+	// a 1xx status isn't a response, the client still gets a final one
+	go client.Write([]byte(
+		"GET /status HTTP/1.1\r\nHost: localhost:42069\r\n\r\n" +
+			"GET /error HTTP/1.1\r\nHost: localhost:42069\r\nConnection: close\r\n\r\n",
+	))
+
+	client.SetReadDeadline(time.Now().Add(5 * time.Second))
+	data, err := io.ReadAll(client)
+	require.NoError(t, err)
+	assert.Equal(t, 2, strings.Count(string(data), "HTTP/1.1 500 Internal Server Error\r\n"))
+	assert.NotContains(t, string(data), "100 Continue")
+}
+
+func TestUnfinishedChunkedResponse(t *testing.T) {
+	handler := func(w *response.Writer, req *request.Request) error {
+		h := headers.NewHeaders()
+		h.Set("Transfer-Encoding", "chunked")
+		if req.RequestLine.RequestTarget == "/trailers" {
+			h.Set("Trailer", "X-Checksum")
+		}
+		w.WriteStatusLine(response.StatusOK)
+		w.WriteHeaders(h)
+		w.WriteChunkedBody([]byte(req.RequestLine.RequestTarget))
+		return nil
+	}
+
+	client, conn := net.Pipe()
+	s := newServer(nil, true, Config{Handler: handler})
+	go s.ServeConn(conn)
+
+	go client.Write([]byte(
+		"GET /open HTTP/1.1\r\nHost: localhost:42069\r\n\r\n" +
+			"GET /trailers HTTP/1.1\r\nHost: localhost:42069\r\nConnection: close\r\n\r\n",
+	))
+
+	client.SetReadDeadline(time.Now().Add(5 * time.Second))
+	data, err := io.ReadAll(client)
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n5\r\n/open\r\n0\r\n\r\n"+
+		"HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\nTrailer: X-Checksum\r\nConnection: close\r\n\r\n9\r\n/trailers\r\n0\r\n\r\n", string(data))
+}
+
+func TestHandlerPanic(t *testing.T) {
+	handler := func(w *response.Writer, req *request.Request) error {
+		switch req.RequestLine.RequestTarget {
+		case "/panic":
+			panic("boom")
+		case "/late-panic":
+			// the status line isn't sent yet, so the 500 can still replace it
+			w.WriteStatusLine(response.StatusOK)
+			panic("boom")
+		}
+		w.WriteStatusLine(response.StatusOK)
+		w.WriteHeaders(response.GetDefaultHeaders(0))
+		return nil
+	}
+
+	// Test: panic after the status line
+	client, conn := net.Pipe()
+	s := newServer(nil, true, Config{Handler: handler})
+	go s.ServeConn(conn)
+	go client.Write([]byte("GET /late-panic HTTP/1.1\r\nHost: localhost:42069\r\n\r\n"))
+	client.SetReadDeadline(time.Now().Add(5 * time.Second))
+	data, err := io.ReadAll(client)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(data), "HTTP/1.1 500 Internal Server Error\r\n"))
+	assert.NotContains(t, string(data), "200 OK")
+
+	client, conn = net.Pipe()
+	reported := make(chan any, 1)
+	s = newServer(nil, true, Config{
+		Handler: handler,
+		OnPanic: func(req *request.Request, recovered any, stack []byte) {
+			assert.Equal(t, "/panic", req.RequestLine.RequestTarget)
+			assert.NotEmpty(t, stack)
+			reported <- recovered
+		},
+	})
+	go s.ServeConn(conn)
+
+	// the connection is closed after the panic, so the second request is never served
+	go client.Write([]byte(
+		"GET /panic HTTP/1.1\r\nHost: localhost:42069\r\n\r\n" +
+			"GET /ok HTTP/1.1\r\nHost: localhost:42069\r\n\r\n",
+	))
+
+	client.SetReadDeadline(time.Now().Add(5 * time.Second))
+	data, err = io.ReadAll(client)
+	require.NoError(t, err)
+	responses := string(data)
+	assert.True(t, strings.HasPrefix(responses, "HTTP/1.1 500 Internal Server Error\r\n"))
+	assert.Contains(t, responses, "Connection: close\r\n")
+	assert.NotContains(t, responses, "200 OK")
+	assert.Equal(t, "boom", <-reported)
+}
+
+func TestShutdown(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	handler := func(w *response.Writer, req *request.Request) error {
+		if req.RequestLine.RequestTarget == "/slow" {
+			close(started)
+			<-release
+		}
+		w.WriteStatusLine(response.StatusOK)
+		w.WriteHeaders(response.GetDefaultHeaders(0))
+		return nil
+	}
+	s, err := ListenAndServe(Config{Address: "127.0.0.1:0", Handler: handler})
+	require.NoError(t, err)
+	listener := s.listener
+
+	// an idle keep-alive connection
+	idle, err := net.Dial("tcp", listener.Addr().String())
+	require.NoError(t, err)
+	defer idle.Close()
+	idle.Write([]byte("GET / HTTP/1.1\r\nHost: localhost:42069\r\n\r\n"))
+	buf := make([]byte, 1024)
+	_, err = idle.Read(buf)
+	require.NoError(t, err)
+
+	// a connection with a request in flight
+	active, err := net.Dial("tcp", listener.Addr().String())
+	require.NoError(t, err)
+	defer active.Close()
+	active.Write([]byte("GET /slow HTTP/1.1\r\nHost: localhost:42069\r\n\r\n"))
+	<-started
+
+	shutdownDone := make(chan error)
+	go func() {
+		shutdownDone <- s.Shutdown(context.Background())
+	}()
+
+	// the idle connection is closed right away
+	idle.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, err = idle.Read(buf)
+	require.ErrorIs(t, err, io.EOF)
+
+	// new connections are refused
+	_, err = net.Dial("tcp", listener.Addr().String())
+	require.Error(t, err)
+
+	// the in-flight request is allowed to finish
+	select {
+	case <-shutdownDone:
+		t.Fatal("Shutdown returned before the in-flight request finished")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	active.SetReadDeadline(time.Now().Add(5 * time.Second))
+	data, err := io.ReadAll(active)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(data), "HTTP/1.1 200 OK\r\n"))
+	require.NoError(t, <-shutdownDone)
+}
+
+func TestShutdownPartialRequest(t *testing.T) {
+	handler := func(w *response.Writer, req *request.Request) error {
+		w.WriteStatusLine(response.StatusOK)
+		w.WriteHeaders(response.GetDefaultHeaders(0))
+		return nil
+	}
+	s, err := ListenAndServe(Config{Address: "127.0.0.1:0", Handler: handler})
+	require.NoError(t, err)
+
+	// a request whose headers are still arriving isn't idle
+	conn, err := net.Dial("tcp", s.listener.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost:42069\r\n"))
+	time.Sleep(50 * time.Millisecond)
+
+	shutdownDone := make(chan error)
+	go func() {
+		shutdownDone <- s.Shutdown(context.Background())
+	}()
+	time.Sleep(50 * time.Millisecond)
+	conn.Write([]byte("\r\n"))
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	data, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(data), "HTTP/1.1 200 OK\r\n"))
+	assert.Contains(t, string(data), "Connection: close\r\n")
+	require.NoError(t, <-shutdownDone)
+}
+
+func TestShutdownDeadline(t *testing.T) {
+	started := make(chan struct{})
+	handler := func(w *response.Writer, req *request.Request) error {
+		close(started)
+		time.Sleep(time.Second)
+		return nil
+	}
+	s, err := ListenAndServe(Config{Address: "127.0.0.1:0", Handler: handler})
+	require.NoError(t, err)
+	listener := s.listener
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	conn.Write([]byte("GET /stuck HTTP/1.1\r\nHost: localhost:42069\r\n\r\n"))
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, s.Shutdown(ctx), context.DeadlineExceeded)
+
+	// the connection was closed forcibly
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, err = io.ReadAll(conn)
+	require.NoError(t, err)
+}
+
+func TestTimeouts(t *testing.T) {
+	handler := func(w *response.Writer, req *request.Request) error {
+		if _, err := req.ReadBody(); err != nil {
+			return err
+		}
+		w.WriteStatusLine(response.StatusOK)
+		w.WriteHeaders(response.GetDefaultHeaders(0))
+		return nil
+	}
+	s := newServer(nil, true, Config{
+		Handler: handler,
+		Timeouts: &Timeouts{
+			ReadHeader: 50 * time.Millisecond,
+			ReadBody:   50 * time.Millisecond,
+			Idle:       50 * time.Millisecond,
+		},
+	})
+
+	// Test: headers that never finish get a 408
+	client, conn := net.Pipe()
+	go s.ServeConn(conn)
+	go client.Write([]byte("GET / HTTP/1.1\r\nHost: local"))
+	client.SetReadDeadline(time.Now().Add(5 * time.Second))
+	data, err := io.ReadAll(client)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(data), "HTTP/1.1 408 Request Timeout\r\n"))
+	assert.Contains(t, string(data), "Connection: close\r\n")
+
+	// Test: an idle connection is closed without a response
+	client, conn = net.Pipe()
+	go s.ServeConn(conn)
+	go client.Write([]byte("GET / HTTP/1.1\r\nHost: localhost:42069\r\n\r\n"))
+	client.SetReadDeadline(time.Now().Add(5 * time.Second))
+	data, err = io.ReadAll(client)
+	require.NoError(t, err)
+	assert.Equal(t, 1, strings.Count(string(data), "HTTP/1.1 200 OK\r\n"))
+	assert.NotContains(t, string(data), "408")
+
+	// Test: a body that never finishes fails the handler reading it with a 408
+	client, conn = net.Pipe()
+	go s.ServeConn(conn)
+	go client.Write([]byte("POST / HTTP/1.1\r\nHost: localhost:42069\r\nContent-Length: 10\r\n\r\nhel"))
+	client.SetReadDeadline(time.Now().Add(5 * time.Second))
+	data, err = io.ReadAll(client)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(data), "HTTP/1.1 408 Request Timeout\r\n"))
+	assert.Contains(t, string(data), "Connection: close\r\n")
+}
+
+func TestRequestErrors(t *testing.T) {
+	handler := func(w *response.Writer, req *request.Request) error {
+		w.WriteStatusLine(response.StatusOK)
+		w.WriteHeaders(response.GetDefaultHeaders(0))
+		return nil
+	}
+	s := newServer(nil, true, Config{
+		Handler: handler,
+		Limits: &request.Limits{
+			MaxRequestLineBytes: 32,
+			MaxHeaderBytes:      64,
+			MaxBodyBytes:        8,
+		},
+	})
+
+	tests := map[string]string{
+		"GET /" + strings.Repeat("a", 64) + " HTTP/1.1\r\n":                       "HTTP/1.1 414 URI Too Long\r\n",
+		"GET / HTTP/1.1\r\nCookie: " + strings.Repeat("a", 64) + "\r\n\r\n":       "HTTP/1.1 431 Request Header Fields Too Large\r\n",
+		"POST / HTTP/1.1\r\nHost: localhost:42069\r\nContent-Length: 100\r\n\r\n": "HTTP/1.1 413 Content Too Large\r\n",
+		"GET / HTTP/2.0\r\nHost: localhost:42069\r\n\r\n":                         "HTTP/1.1 505 HTTP Version Not Supported\r\n",
+		"GET / HTTP/1.1\r\n\r\n":                                                  "HTTP/1.1 400 Bad Request\r\n",
+		"GET / HTTP/1.1\r\nBad Header: 1\r\n\r\n":                                 "HTTP/1.1 400 Bad Request\r\n",
+	}
+	for raw, statusLine := range tests {
+		client, conn := net.Pipe()
+		go s.ServeConn(conn)
+		go client.Write([]byte(raw))
+		client.SetReadDeadline(time.Now().Add(5 * time.Second))
+		data, err := io.ReadAll(client)
+		require.NoError(t, err)
+		assert.True(t, strings.HasPrefix(string(data), statusLine), string(data))
+		assert.Contains(t, string(data), "Connection: close\r\n")
+	}
+
+	// Test: a smuggling attempt is rejected and the smuggled request never served
+	client, conn := net.Pipe()
+	go s.ServeConn(conn)
+	go client.Write([]byte("POST / HTTP/1.1\r\nHost: a\r\nContent-Length: 5\r\nTransfer-Encoding: chunked\r\n\r\n" +
+		"0\r\n\r\nGET /admin HTTP/1.1\r\nHost: localhost:42069\r\n\r\n"))
+	client.SetReadDeadline(time.Now().Add(5 * time.Second))
+	data, err := io.ReadAll(client)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(data), "HTTP/1.1 400 Bad Request\r\n"))
+	assert.Equal(t, 1, strings.Count(string(data), "HTTP/1.1 "))
+
+	// Test: transfer codings other than chunked aren't implemented
+	client, conn = net.Pipe()
+	go s.ServeConn(conn)
+	go client.Write([]byte("POST / HTTP/1.1\r\nHost: localhost:42069\r\nTransfer-Encoding: gzip, chunked\r\n\r\n"))
+	client.SetReadDeadline(time.Now().Add(5 * time.Second))
+	data, err = io.ReadAll(client)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(data), "HTTP/1.1 501 Not Implemented\r\n"))
+}
+
+func TestServeListener(t *testing.T) {
+	handler := func(w *response.Writer, req *request.Request) error {
+		w.WriteStatusLine(response.StatusNoContent)
+		w.WriteHeaders(response.GetDefaultHeaders(0))
+		return nil
+	}
+	opened := make(chan net.Conn, 1)
+	closed := make(chan net.Conn, 1)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := ServeListener(listener, Config{
+		Handler:     handler,
+		OnConnOpen:  func(conn net.Conn) { opened <- conn },
+		OnConnClose: func(conn net.Conn) { closed <- conn },
+	})
+	defer s.Close()
+
+	client, err := net.Dial("tcp", listener.Addr().String())
+	require.NoError(t, err)
+	defer client.Close()
+	client.Write([]byte("GET / HTTP/1.1\r\nHost: localhost:42069\r\nConnection: close\r\n\r\n"))
+	client.SetReadDeadline(time.Now().Add(5 * time.Second))
+	data, err := io.ReadAll(client)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(data), "HTTP/1.1 204 No Content\r\n"))
+
+	conn := <-opened
+	assert.Equal(t, conn, <-closed)
+}